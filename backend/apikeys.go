@@ -1,52 +1,322 @@
 package backend
 
 import (
-	"database/sql"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
-	"math/rand"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
-// CheckAPIKey checks if the given string is a correct API key
-// (refer to NewAPIKey() for generating API keys)
-func (b *Backend) CheckAPIKey(apiKey string) error {
-	err := b.db.Get(&apiKey, "select value from api_key where value = $1", apiKey)
-	switch err {
-	case nil:
-		return nil
-	case sql.ErrNoRows:
-		return ErrWrongAPIKey
-	default:
-		return fmt.Errorf("database error: %s", err)
+// Scope is something an API key is allowed to do
+type Scope string
+
+const (
+	// ScopeStatic allows access to data from the database (schedules,
+	// stops, routes etc)
+	ScopeStatic Scope = "static"
+	// ScopeRealtime allows access to realtime data, which costs requests
+	// to SKGT's servers
+	ScopeRealtime Scope = "realtime"
+	// ScopeAdmin allows access to administrative endpoints
+	ScopeAdmin Scope = "admin"
+)
+
+// DefaultScopes are the scopes of API keys created without explicit scopes
+var DefaultScopes = []Scope{ScopeStatic, ScopeRealtime}
+
+// ParseScopes parses a comma-separated list of scopes
+func ParseScopes(input string) ([]Scope, error) {
+	var scopes []Scope
+	for _, name := range strings.Split(input, ",") {
+		scope := Scope(strings.TrimSpace(name))
+		switch scope {
+		case "":
+			continue
+		case ScopeStatic, ScopeRealtime, ScopeAdmin:
+			scopes = append(scopes, scope)
+		default:
+			return nil, fmt.Errorf("unknown scope [%s]", scope)
+		}
+	}
+
+	return scopes, nil
+}
+
+// APIKey describes an API key. Only its prefix is known, since the key
+// itself is only stored as a hash.
+type APIKey struct {
+	ID        int64
+	Prefix    string
+	Label     string
+	CreatedAt time.Time
+	ExpiresAt *time.Time // nil for keys which never expire
+	Scopes    []Scope
+}
+
+// HasScope checks if the key has the given scope
+func (k *APIKey) HasScope(scope Scope) bool {
+	for i := range k.Scopes {
+		if k.Scopes[i] == scope {
+			return true
+		}
 	}
+	return false
 }
 
-// DeleteAPIKey deletes an API key from the database
+// Expired checks if the key has expired at the given time
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// apiKeyRow is an API key as stored in the database
+type apiKeyRow struct {
+	ID        int64
+	Prefix    string
+	Salt      string
+	Hash      string
+	Label     string
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+	Scopes    string
+}
+
+func (r *apiKeyRow) apiKey() (*APIKey, error) {
+	scopes, err := ParseScopes(r.Scopes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scopes for API key %s: %s", r.Prefix, err)
+	}
+
+	return &APIKey{
+		ID:        r.ID,
+		Prefix:    r.Prefix,
+		Label:     r.Label,
+		CreatedAt: r.CreatedAt,
+		ExpiresAt: r.ExpiresAt,
+		Scopes:    scopes,
+	}, nil
+}
+
+// matches checks if the row is the hash of the given key
+func (r *apiKeyRow) matches(apiKey string) bool {
+	salt, err := hex.DecodeString(r.Salt)
+	if err != nil {
+		return false
+	}
+
+	expected, err := hex.DecodeString(r.Hash)
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(hashAPIKey(apiKey, salt), expected) == 1
+}
+
+// CheckAPIKey checks if the given string is a correct API key which hasn't
+// expired and returns it (refer to NewAPIKey() for generating API keys)
+func (b *Backend) CheckAPIKey(apiKey string) (*APIKey, error) {
+	row, err := b.findAPIKey(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := row.apiKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Expired(time.Now()) {
+		return nil, ErrExpiredAPIKey
+	}
+
+	return key, nil
+}
+
+// findAPIKey finds the stored hash of an API key
+func (b *Backend) findAPIKey(apiKey string) (*apiKeyRow, error) {
+	if len(apiKey) != apiKeyLength {
+		return nil, ErrWrongAPIKey
+	}
+
+	var rows []*apiKeyRow
+	err := b.db.Select(&rows, GET_API_KEYS_BY_PREFIX, apiKey[:apiKeyPrefixLength])
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", err)
+	}
+
+	for _, row := range rows {
+		if row.matches(apiKey) {
+			return row, nil
+		}
+	}
+
+	return nil, ErrWrongAPIKey
+}
+
+// APIKeys returns all API keys, including expired ones
+func (b *Backend) APIKeys() ([]*APIKey, error) {
+	var rows []*apiKeyRow
+	err := b.db.Select(&rows, GET_API_KEYS)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", err)
+	}
+
+	keys := make([]*APIKey, len(rows))
+	for i := range rows {
+		keys[i], err = rows[i].apiKey()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey deletes an API key from the database. The key may be given
+// either in full or by its prefix, as long as the prefix is unique.
 func (b *Backend) DeleteAPIKey(apiKey string) error {
-	_, err := b.db.Exec("delete from api_key where value = $1", apiKey)
-	switch err {
-	case nil:
-		return nil
-	case sql.ErrNoRows:
-		return ErrWrongAPIKey
-	default:
+	id, err := b.resolveAPIKey(apiKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.db.Exec(DELETE_API_KEY, id)
+	if err != nil {
 		return fmt.Errorf("database error: %s", err)
 	}
+	return nil
 }
 
-const apiKeySymbols = "abcdefghijklmnopqrstuvwxyz0123456789"
+// resolveAPIKey returns the ID of an API key given either in full or by
+// its prefix
+func (b *Backend) resolveAPIKey(apiKey string) (int64, error) {
+	if len(apiKey) != apiKeyPrefixLength {
+		row, err := b.findAPIKey(apiKey)
+		if err != nil {
+			return 0, err
+		}
+		return row.ID, nil
+	}
 
-// NewAPIKey generates a valid API key and returns it
-func (b *Backend) NewAPIKey() (string, error) {
-	keyBytes := make([]byte, 64)
-	for i := range keyBytes {
-		keyBytes[i] = apiKeySymbols[rand.Intn(len(apiKeySymbols))]
+	var rows []*apiKeyRow
+	err := b.db.Select(&rows, GET_API_KEYS_BY_PREFIX, apiKey)
+	if err != nil {
+		return 0, fmt.Errorf("database error: %s", err)
+	}
+
+	switch len(rows) {
+	case 0:
+		return 0, ErrWrongAPIKey
+	case 1:
+		return rows[0].ID, nil
+	default:
+		return 0, fmt.Errorf("%d API keys start with %s", len(rows), apiKey)
+	}
+}
+
+const (
+	apiKeySymbols      = "abcdefghijklmnopqrstuvwxyz0123456789"
+	apiKeyLength       = 64
+	apiKeyPrefixLength = 8
+	apiKeySaltLength   = 16
+)
+
+// NewAPIKey generates a valid API key with the given owner label, expiry
+// time (nil if it never expires) and scopes (DefaultScopes if empty) and
+// returns it. Only a hash of the key is stored, so it can't be shown again.
+func (b *Backend) NewAPIKey(label string, expiresAt *time.Time, scopes ...Scope) (string, error) {
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+
+	scopeNames := make([]string, len(scopes))
+	for i := range scopes {
+		scopeNames[i] = string(scopes[i])
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		return "", fmt.Errorf("unable to generate api key: %s", err)
 	}
 
-	key := string(keyBytes)
+	salt, err := randomSalt()
+	if err != nil {
+		return "", fmt.Errorf("unable to generate salt: %s", err)
+	}
 
-	_, err := b.db.Exec("insert into api_key(value) values($1)", key)
+	_, err = b.db.Exec(
+		INSERT_API_KEY,
+		key[:apiKeyPrefixLength], hex.EncodeToString(salt),
+		hex.EncodeToString(hashAPIKey(key, salt)),
+		label, expiresAt, strings.Join(scopeNames, ","),
+	)
 	if err != nil {
 		return "", fmt.Errorf("unable to create api key: %s", err)
 	}
 	return key, nil
 }
+
+func generateAPIKey() (string, error) {
+	symbols := big.NewInt(int64(len(apiKeySymbols)))
+
+	keyBytes := make([]byte, apiKeyLength)
+	for i := range keyBytes {
+		n, err := rand.Int(rand.Reader, symbols)
+		if err != nil {
+			return "", err
+		}
+		keyBytes[i] = apiKeySymbols[n.Int64()]
+	}
+
+	return string(keyBytes), nil
+}
+
+func randomSalt() ([]byte, error) {
+	salt := make([]byte, apiKeySaltLength)
+	_, err := rand.Read(salt)
+	return salt, err
+}
+
+func hashAPIKey(apiKey string, salt []byte) []byte {
+	hash := sha256.New()
+	hash.Write(salt)
+	hash.Write([]byte(apiKey))
+	return hash.Sum(nil)
+}
+
+// hashPlaintextAPIKeys replaces the API keys stored in plaintext by
+// older versions with their hashes
+func hashPlaintextAPIKeys(tx *sqlx.Tx) error {
+	var keys []string
+	err := tx.Select(&keys, GET_PLAINTEXT_API_KEYS)
+	if err != nil {
+		return fmt.Errorf("unable to select api keys: %s", err)
+	}
+
+	for _, key := range keys {
+		salt, err := randomSalt()
+		if err != nil {
+			return fmt.Errorf("unable to generate salt: %s", err)
+		}
+
+		_, err = tx.Exec(
+			HASH_PLAINTEXT_API_KEY, key, key[:apiKeyPrefixLength],
+			hex.EncodeToString(salt), hex.EncodeToString(hashAPIKey(key, salt)),
+		)
+		if err != nil {
+			return fmt.Errorf("unable to hash api key: %s", err)
+		}
+	}
+
+	_, err = tx.Exec(DROP_PLAINTEXT_API_KEYS)
+	if err != nil {
+		return fmt.Errorf("unable to drop plaintext api keys: %s", err)
+	}
+
+	return nil
+}
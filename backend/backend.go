@@ -33,11 +33,12 @@ func (b *Backend) Info() (string, error) {
 	return "skgt-api, pre-release", nil
 }
 
-// InitDB initialises the database (creates tables, constraints etc)
+// InitDB initialises the database (creates tables, constraints etc),
+// applying all migrations which haven't been applied yet
 func (b *Backend) InitDB() error {
-	_, err := b.db.Exec(schema)
+	err := b.Migrate(LatestSchemaVersion())
 	if err != nil {
-		return fmt.Errorf("unable to execute schema: %s", err)
+		return fmt.Errorf("unable to migrate schema: %s", err)
 	}
 	return nil
 }
@@ -45,9 +46,14 @@ func (b *Backend) InitDB() error {
 // DropDB drops the database, performing the reverse operations of those
 // InitDB() does
 func (b *Backend) DropDB() error {
-	_, err := b.db.Exec(dropSchema)
+	err := b.Migrate(0)
 	if err != nil {
 		return fmt.Errorf("unable to drop schema: %s", err)
 	}
+
+	_, err = b.db.Exec(DROP_MIGRATIONS_TABLE)
+	if err != nil {
+		return fmt.Errorf("unable to drop migrations table: %s", err)
+	}
 	return nil
 }
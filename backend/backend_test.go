@@ -1,12 +1,15 @@
 package backend
 
 import (
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -61,20 +64,110 @@ func TestBackend_CheckAPIKey(t *testing.T) {
 	backend := openBackend(t)
 	defer closeBackend(t, backend)
 
-	apiKey, err := backend.NewAPIKey()
+	apiKey, err := backend.NewAPIKey("test", nil)
 	if err != nil {
 		t.Fatalf("cannot create api key: %s", err)
 	}
 
-	err = backend.CheckAPIKey(apiKey)
+	key, err := backend.CheckAPIKey(apiKey)
 	if err != nil {
 		t.Fatalf("generated api key is wrong: %s", err)
 	}
 
-	err = backend.CheckAPIKey("42")
+	if key.Label != "test" || key.ExpiresAt != nil {
+		t.Errorf("wrong metadata for api key: %+v", key)
+	}
+	if !key.HasScope(ScopeStatic) || !key.HasScope(ScopeRealtime) || key.HasScope(ScopeAdmin) {
+		t.Errorf("wrong default scopes for api key: %v", key.Scopes)
+	}
+
+	_, err = backend.CheckAPIKey("42")
 	if err != ErrWrongAPIKey {
 		t.Fatalf("wrong error for wrong api key: %s", err)
 	}
+
+	// same prefix, different key
+	wrongKey := apiKey[:apiKeyPrefixLength] + strings.Repeat("0", apiKeyLength-apiKeyPrefixLength)
+	_, err = backend.CheckAPIKey(wrongKey)
+	if err != ErrWrongAPIKey {
+		t.Fatalf("wrong error for wrong api key with a valid prefix: %s", err)
+	}
+
+	err = backend.DeleteAPIKey(key.Prefix)
+	if err != nil {
+		t.Fatalf("cannot delete api key by prefix: %s", err)
+	}
+
+	_, err = backend.CheckAPIKey(apiKey)
+	if err != ErrWrongAPIKey {
+		t.Fatalf("wrong error for deleted api key: %s", err)
+	}
+}
+
+func TestBackend_CheckAPIKey_Expired(t *testing.T) {
+	backend := openBackend(t)
+	defer closeBackend(t, backend)
+
+	expired := time.Now().Add(-time.Hour)
+	apiKey, err := backend.NewAPIKey("old", &expired, ScopeStatic)
+	if err != nil {
+		t.Fatalf("cannot create api key: %s", err)
+	}
+
+	_, err = backend.CheckAPIKey(apiKey)
+	if err != ErrExpiredAPIKey {
+		t.Fatalf("wrong error for expired api key: %s", err)
+	}
+
+	keys, err := backend.APIKeys()
+	if err != nil {
+		t.Fatalf("cannot list api keys: %s", err)
+	}
+	if len(keys) != 1 || keys[0].Label != "old" || !keys[0].Expired(time.Now()) {
+		t.Errorf("wrong api key list: %+v", keys)
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	apiKey, err := generateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apiKey) != apiKeyLength {
+		t.Fatalf("api key has length %d", len(apiKey))
+	}
+
+	salt, err := randomSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := &apiKeyRow{
+		Salt: hex.EncodeToString(salt),
+		Hash: hex.EncodeToString(hashAPIKey(apiKey, salt)),
+	}
+
+	if !row.matches(apiKey) {
+		t.Errorf("api key doesn't match its hash")
+	}
+	if row.matches(apiKey[1:] + "x") {
+		t.Errorf("wrong api key matches hash")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	scopes, err := ParseScopes("static, admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal([]Scope{ScopeStatic, ScopeAdmin}, scopes)
+
+	_, err = ParseScopes("static,everything")
+	if err == nil {
+		t.Errorf("unknown scope was accepted")
+	}
 }
 
 func TestBackend_Info(t *testing.T) {
@@ -4,3 +4,12 @@ import "errors"
 
 // ErrWrongAPIKey is returned upon a wrong API key
 var ErrWrongAPIKey = errors.New("wrong API key")
+
+// ErrNoSuchLine is returned when a line doesn't exist
+var ErrNoSuchLine = errors.New("no such line")
+
+// ErrNoSuchStop is returned when a stop doesn't exist
+var ErrNoSuchStop = errors.New("no such stop")
+
+// ErrExpiredAPIKey is returned upon an API key which has expired
+var ErrExpiredAPIKey = errors.New("API key has expired")
@@ -2,52 +2,394 @@ package backend
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/DexterLB/skgt_api/common"
 	"github.com/DexterLB/skgt_api/schedules"
 	"github.com/jmoiron/sqlx"
 )
 
+// UpdateSummary describes the changes Fill has made to the database.
+// Version is the ID of the dataset version created by the update, or of the
+// current one if the update didn't change anything.
+type UpdateSummary struct {
+	Version uint64
+
+	Lines  Changes
+	Routes Changes
+	Stops  Changes
+}
+
+// Empty checks if the update didn't change anything
+func (s *UpdateSummary) Empty() bool {
+	return s.Lines.Empty() && s.Routes.Empty() && s.Stops.Empty()
+}
+
+// Changes contains human-readable names of added, removed and changed items
+type Changes struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty checks if there are no changes
+func (c *Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+func (c *Changes) sort() {
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.Strings(c.Changed)
+}
+
 // Fill populstes the database with the given stops and timetables
-// (replacing all previous content)
-func (b *Backend) Fill(stops []*common.Stop, timetables []*schedules.Timetable) (err error) {
-	_, err = b.Wrap(func(tx *sqlx.Tx) (interface{}, error) {
-		// first clear all of the old data
-		_, err = tx.Exec(clearTransportSchema)
+// (replacing all previous content). Only the differences from the current
+// content are written, and lines and routes which still exist keep their IDs.
+// Each call which changes anything creates a new dataset version, recording
+// the timetable changes.
+func (b *Backend) Fill(stops []*common.Stop, timetables []*schedules.Timetable) (*UpdateSummary, error) {
+	data, err := b.Wrap(func(tx *sqlx.Tx) (interface{}, error) {
+		summary := &UpdateSummary{}
+		history := &history{}
+
+		oldStops, err := fillStops(tx, stops, summary)
 		if err != nil {
-			return nil, fmt.Errorf("cannot clear data before inserting new data: %s", err)
+			return nil, fmt.Errorf("unable to update stops: %s", err)
 		}
 
-		// insert stops
-		for i := range stops {
-			err = insertStop(tx, stops[i])
+		err = fillTimetables(tx, uniqueTimetables(timetables), summary, history)
+		if err != nil {
+			return nil, fmt.Errorf("unable to update timetables: %s", err)
+		}
+
+		// stops can be deleted only after the routes referencing them
+		for _, stop := range oldStops {
+			_, err = tx.Exec(`delete from stop where id = $1`, stop.ID)
 			if err != nil {
-				return nil, fmt.Errorf("unable to insert stop: %s", err)
+				return nil, fmt.Errorf("unable to delete stop: %s", err)
 			}
+			summary.Stops.Removed = append(summary.Stops.Removed, stopName(stop))
 		}
 
-		// insert timetables
-		for i := range timetables {
-			err = insertTimetable(tx, timetables[i])
+		if summary.Empty() {
+			err = tx.Get(&summary.Version, GET_LATEST_DATASET_VERSION)
+			if err != nil {
+				return nil, fmt.Errorf("unable to select dataset version: %s", err)
+			}
+		} else {
+			summary.Version, err = history.save(tx)
 			if err != nil {
-				return nil, fmt.Errorf("unable to insert timetable: %s", err)
+				return nil, fmt.Errorf("unable to save history: %s", err)
 			}
 		}
-		return nil, nil
+
+		summary.Lines.sort()
+		summary.Routes.sort()
+		summary.Stops.sort()
+
+		return summary, nil
 	})
-	return err
+	if err != nil {
+		return nil, err
+	}
+
+	return data.(*UpdateSummary), nil
+}
+
+// fillStops inserts new stops and updates changed ones, returning the stops
+// which are no longer present (and must be deleted)
+func fillStops(tx *sqlx.Tx, stops []*common.Stop, summary *UpdateSummary) ([]*common.Stop, error) {
+	var existing []*common.Stop
+	err := tx.Select(&existing, GET_ALL_STOPS)
+	if err != nil {
+		return nil, fmt.Errorf("unable to select existing stops: %s", err)
+	}
+
+	oldStops := make(map[int]*common.Stop)
+	for _, stop := range existing {
+		oldStops[stop.ID] = stop
+	}
+
+	for _, stop := range stops {
+		oldStop, ok := oldStops[stop.ID]
+		delete(oldStops, stop.ID)
+
+		switch {
+		case !ok:
+			err = insertStop(tx, stop)
+			if err != nil {
+				return nil, fmt.Errorf("unable to insert stop: %s", err)
+			}
+			summary.Stops.Added = append(summary.Stops.Added, stopName(stop))
+		case !sameStop(oldStop, stop):
+			err = updateStop(tx, stop)
+			if err != nil {
+				return nil, fmt.Errorf("unable to update stop: %s", err)
+			}
+			summary.Stops.Changed = append(summary.Stops.Changed, stopName(stop))
+		}
+	}
+
+	var removed []*common.Stop
+	for _, stop := range existing {
+		if _, ok := oldStops[stop.ID]; ok {
+			removed = append(removed, stop)
+		}
+	}
+
+	return removed, nil
+}
+
+// fillTimetables inserts, updates or deletes lines so that they match the
+// given timetables
+func fillTimetables(
+	tx *sqlx.Tx, timetables []*schedules.Timetable, summary *UpdateSummary, history *history,
+) error {
+	var existing []struct {
+		ID      uint64
+		Vehicle common.VehicleType
+		Number  string
+	}
+	err := tx.Select(&existing, `select id, vehicle, number from line`)
+	if err != nil {
+		return fmt.Errorf("unable to select existing lines: %s", err)
+	}
+
+	oldLines := make(map[common.Line]uint64)
+	for _, line := range existing {
+		oldLines[common.Line{Vehicle: line.Vehicle, Number: line.Number}] = line.ID
+	}
+
+	for _, timetable := range timetables {
+		lineID, ok := oldLines[*timetable.Line]
+		delete(oldLines, *timetable.Line)
+
+		if !ok {
+			err = insertTimetable(tx, timetable)
+			if err != nil {
+				return fmt.Errorf("unable to insert timetable: %s", err)
+			}
+			summary.Lines.Added = append(summary.Lines.Added, lineName(timetable.Line))
+			history.record(timetable.Line, "", LineAdded, changeDetails{})
+			for _, route := range timetable.Routes {
+				summary.Routes.Added = append(summary.Routes.Added, routeName(timetable.Line, route.Direction))
+				history.record(timetable.Line, route.Direction, RouteAdded, changeDetails{
+					NewStops: route.Stops,
+				})
+			}
+			continue
+		}
+
+		changed, err := updateTimetable(tx, timetable, lineID, summary, history)
+		if err != nil {
+			return fmt.Errorf("unable to update timetable: %s", err)
+		}
+		if changed {
+			summary.Lines.Changed = append(summary.Lines.Changed, lineName(timetable.Line))
+		}
+	}
+
+	for line, lineID := range oldLines {
+		directions, err := deleteLine(tx, lineID)
+		if err != nil {
+			return fmt.Errorf("unable to delete line: %s", err)
+		}
+		summary.Lines.Removed = append(summary.Lines.Removed, lineName(&line))
+		history.record(&line, "", LineRemoved, changeDetails{})
+		for _, direction := range directions {
+			summary.Routes.Removed = append(summary.Routes.Removed, routeName(&line, direction))
+			history.record(&line, direction, RouteRemoved, changeDetails{})
+		}
+	}
+
+	return nil
+}
+
+// updateTimetable updates the routes of an existing line, returning whether
+// any of them have changed
+func updateTimetable(
+	tx *sqlx.Tx, timetable *schedules.Timetable, lineID uint64,
+	summary *UpdateSummary, history *history,
+) (bool, error) {
+	oldRoutes, err := existingRoutes(tx, lineID)
+	if err != nil {
+		return false, fmt.Errorf("unable to select existing routes: %s", err)
+	}
+
+	matches := matchRoutes(oldRoutes, timetable.Routes)
+
+	// removed routes go first, so that their variants can be reused
+	changed := false
+	variants := make(routeVariants)
+	for _, oldRoute := range oldRoutes {
+		if oldRoute.matched {
+			variants.use(oldRoute.Direction, oldRoute.Variant)
+			continue
+		}
+
+		err = deleteRoute(tx, oldRoute.ID)
+		if err != nil {
+			return false, fmt.Errorf("unable to delete route: %s", err)
+		}
+		summary.Routes.Removed = append(summary.Routes.Removed, routeName(timetable.Line, oldRoute.Direction))
+		history.record(timetable.Line, oldRoute.Direction, RouteRemoved, changeDetails{})
+		changed = true
+	}
+
+	for i, route := range timetable.Routes {
+		name := routeName(timetable.Line, route.Direction)
+
+		if matches[i] == nil {
+			err = insertRoute(tx, route, lineID, variants.next(route.Direction))
+			if err != nil {
+				return false, fmt.Errorf("unable to insert route: %s", err)
+			}
+			summary.Routes.Added = append(summary.Routes.Added, name)
+			history.record(timetable.Line, route.Direction, RouteAdded, changeDetails{
+				NewStops: route.Stops,
+			})
+			changed = true
+			continue
+		}
+
+		routeID := matches[i].ID
+		oldRoute, err := loadRoute(tx, routeID)
+		if err != nil {
+			return false, fmt.Errorf("unable to load route: %s", err)
+		}
+
+		if sameStopIDs(oldRoute.Stops, route.Stops) && sameSchedules(oldRoute.Schedules, route.Schedules) {
+			continue
+		}
+
+		err = deleteRouteData(tx, routeID)
+		if err != nil {
+			return false, fmt.Errorf("unable to delete old route data: %s", err)
+		}
+
+		err = insertRouteData(tx, route, routeID)
+		if err != nil {
+			return false, fmt.Errorf("unable to insert new route data: %s", err)
+		}
+		summary.Routes.Changed = append(summary.Routes.Changed, name)
+		history.recordRoute(timetable.Line, oldRoute, route)
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// existingRoute is a route of a line which is already in the database
+type existingRoute struct {
+	ID        uint64
+	Direction string
+	Variant   int
+	Stops     []int
+
+	matched bool
+}
+
+// existingRoutes reads the routes of a line together with their stops
+func existingRoutes(tx *sqlx.Tx, lineID uint64) ([]*existingRoute, error) {
+	var routes []*existingRoute
+	err := tx.Select(
+		&routes,
+		`select id, direction, variant from route where line = $1 order by id`,
+		lineID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, route := range routes {
+		err = tx.Select(
+			&route.Stops,
+			`select stop from route_stop where route = $1 order by index`,
+			route.ID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("unable to select route stops: %s", err)
+		}
+	}
+
+	return routes, nil
+}
+
+// matchRoutes finds the existing route which corresponds to each of the
+// given ones, or nil for new routes, and marks the found ones as matched.
+// Routes with the same direction and stops are paired first, and only the
+// remaining ones are paired by direction.
+func matchRoutes(oldRoutes []*existingRoute, routes []*schedules.Route) []*existingRoute {
+	matches := make([]*existingRoute, len(routes))
+	for _, sameStops := range []bool{true, false} {
+		for i, route := range routes {
+			if matches[i] != nil {
+				continue
+			}
+			for _, oldRoute := range oldRoutes {
+				if oldRoute.matched || oldRoute.Direction != route.Direction {
+					continue
+				}
+				if sameStops && !sameStopIDs(oldRoute.Stops, route.Stops) {
+					continue
+				}
+				oldRoute.matched = true
+				matches[i] = oldRoute
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// routeVariants holds the variants taken by the routes of a line in each
+// direction
+type routeVariants map[string]map[int]bool
+
+func (v routeVariants) use(direction string, variant int) {
+	if v[direction] == nil {
+		v[direction] = make(map[int]bool)
+	}
+	v[direction][variant] = true
+}
+
+// next takes the smallest free variant in the given direction
+func (v routeVariants) next(direction string) int {
+	variant := 0
+	for v[direction][variant] {
+		variant++
+	}
+	v.use(direction, variant)
+	return variant
 }
 
 func insertStop(tx *sqlx.Tx, stop *common.Stop) error {
 	_, err := tx.NamedExec(
-		`insert into stop(id, name, description, latitude, longitude)
-	     values (:id, :name, :description, :latitude, :longitude)`,
+		`insert into stop(id, name, international_name, community_name,
+			description, latitude, longitude)
+	     values (:id, :name, :international_name, :community_name,
+			:description, :latitude, :longitude)`,
 		stop,
 	)
 	return err
 
 }
 
+func updateStop(tx *sqlx.Tx, stop *common.Stop) error {
+	_, err := tx.NamedExec(
+		`update stop set name = :name,
+			international_name = :international_name,
+			community_name = :community_name,
+			description = :description,
+			latitude = :latitude,
+			longitude = :longitude
+		 where id = :id`,
+		stop,
+	)
+	return err
+}
+
 func insertTimetable(tx *sqlx.Tx, timetable *schedules.Timetable) error {
 	var lineID uint64
 	err := tx.Get(
@@ -60,8 +402,9 @@ func insertTimetable(tx *sqlx.Tx, timetable *schedules.Timetable) error {
 		return err
 	}
 
-	for i := range timetable.Routes {
-		err = insertRoute(tx, timetable.Routes[i], lineID)
+	variants := make(routeVariants)
+	for _, route := range timetable.Routes {
+		err = insertRoute(tx, route, lineID, variants.next(route.Direction))
 		if err != nil {
 			return fmt.Errorf("unable to insert route: %s", err)
 		}
@@ -70,20 +413,25 @@ func insertTimetable(tx *sqlx.Tx, timetable *schedules.Timetable) error {
 	return nil
 }
 
-func insertRoute(tx *sqlx.Tx, route *schedules.Route, lineID uint64) error {
+func insertRoute(tx *sqlx.Tx, route *schedules.Route, lineID uint64, variant int) error {
 	var routeID uint64
 	err := tx.Get(
 		&routeID,
-		`insert into route(id, line, direction)
-		 values(default, $1, $2) returning id`,
-		lineID, route.Direction,
+		`insert into route(id, line, direction, variant)
+		 values(default, $1, $2, $3) returning id`,
+		lineID, route.Direction, variant,
 	)
 	if err != nil {
 		return err
 	}
 
+	return insertRouteData(tx, route, routeID)
+}
+
+// insertRouteData inserts the stops and arrivals of a route
+func insertRouteData(tx *sqlx.Tx, route *schedules.Route, routeID uint64) error {
 	for i := range route.Stops {
-		_, err = tx.Exec(
+		_, err := tx.Exec(
 			`insert into route_stop(route, index, stop)
 			 values($1, $2, $3)`,
 			routeID, i+1, route.Stops[i],
@@ -96,7 +444,7 @@ func insertRoute(tx *sqlx.Tx, route *schedules.Route, lineID uint64) error {
 	for scheduleType := range route.Schedules {
 		for courseIndex, course := range route.Schedules[scheduleType] {
 			for stopIndex := range course {
-				_, err = tx.Exec(
+				_, err := tx.Exec(
 					`insert into arrival(route, stop, course, time, day_type)
 				 	 values($1, $2, $3, $4, $5)`,
 					routeID,
@@ -105,12 +453,206 @@ func insertRoute(tx *sqlx.Tx, route *schedules.Route, lineID uint64) error {
 					course[stopIndex],
 					scheduleType,
 				)
-			}
-			if err != nil {
-				return fmt.Errorf("unable to insert arrival: %s", err)
+				if err != nil {
+					return fmt.Errorf("unable to insert arrival: %s", err)
+				}
 			}
 		}
 	}
 
 	return nil
 }
+
+// loadRoute reads the stops and schedules of a route from the database
+func loadRoute(tx *sqlx.Tx, routeID uint64) (*schedules.Route, error) {
+	route := &schedules.Route{
+		Schedules: make(map[schedules.ScheduleType][]schedules.Course),
+	}
+
+	err := tx.Select(
+		&route.Stops,
+		`select stop from route_stop where route = $1 order by index`,
+		routeID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to select route stops: %s", err)
+	}
+
+	stopIndices := make(map[int]int)
+	for i, stop := range route.Stops {
+		stopIndices[stop] = i
+	}
+
+	var arrivals []struct {
+		Stop    int
+		Course  int
+		Time    *schedules.Time
+		DayType schedules.ScheduleType
+	}
+	err = tx.Select(
+		&arrivals,
+		`select stop, course, time, day_type as dayType from arrival
+		 where route = $1`,
+		routeID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to select arrivals: %s", err)
+	}
+
+	for _, arrival := range arrivals {
+		courses := route.Schedules[arrival.DayType]
+		for len(courses) < arrival.Course {
+			courses = append(courses, make(schedules.Course, len(route.Stops)))
+		}
+		courses[arrival.Course-1][stopIndices[arrival.Stop]] = arrival.Time
+		route.Schedules[arrival.DayType] = courses
+	}
+
+	return route, nil
+}
+
+// deleteRouteData deletes the stops and arrivals of a route
+func deleteRouteData(tx *sqlx.Tx, routeID uint64) error {
+	_, err := tx.Exec(`delete from arrival where route = $1`, routeID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`delete from route_stop where route = $1`, routeID)
+	return err
+}
+
+func deleteRoute(tx *sqlx.Tx, routeID uint64) error {
+	err := deleteRouteData(tx, routeID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`delete from route where id = $1`, routeID)
+	return err
+}
+
+// deleteLine deletes a line with all of its routes, returning the
+// directions of the deleted routes
+func deleteLine(tx *sqlx.Tx, lineID uint64) ([]string, error) {
+	var routes []struct {
+		ID        uint64
+		Direction string
+	}
+	err := tx.Select(&routes, `select id, direction from route where line = $1`, lineID)
+	if err != nil {
+		return nil, err
+	}
+
+	directions := make([]string, len(routes))
+	for i, route := range routes {
+		err = deleteRoute(tx, route.ID)
+		if err != nil {
+			return nil, err
+		}
+		directions[i] = route.Direction
+	}
+
+	_, err = tx.Exec(`delete from line where id = $1`, lineID)
+	return directions, err
+}
+
+// uniqueTimetables removes all but the first timetable for each line
+func uniqueTimetables(timetables []*schedules.Timetable) []*schedules.Timetable {
+	seen := make(map[common.Line]bool)
+	var unique []*schedules.Timetable
+	for _, timetable := range timetables {
+		if !seen[*timetable.Line] {
+			seen[*timetable.Line] = true
+			unique = append(unique, timetable)
+		}
+	}
+	return unique
+}
+
+func sameStop(a *common.Stop, b *common.Stop) bool {
+	// coordinates are stored as single-precision numbers
+	return a.Name == b.Name &&
+		a.InternationalName == b.InternationalName &&
+		a.CommunityName == b.CommunityName &&
+		a.Description == b.Description &&
+		float32(a.Latitude) == float32(b.Latitude) &&
+		float32(a.Longitude) == float32(b.Longitude)
+}
+
+// sameStopIDs checks if two slices of stop IDs are the same
+func sameStopIDs(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameSchedules compares the courses for all day types, treating missing
+// day types as having no courses
+func sameSchedules(a map[schedules.ScheduleType][]schedules.Course, b map[schedules.ScheduleType][]schedules.Course) bool {
+	for dayType := range a {
+		if !sameCourses(a[dayType], b[dayType]) {
+			return false
+		}
+	}
+	for dayType := range b {
+		if !sameCourses(a[dayType], b[dayType]) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameCourses(a []schedules.Course, b []schedules.Course) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameCourse(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameCourse compares two courses, treating missing times at the end of a
+// course as if the vehicle doesn't stop there
+func sameCourse(a schedules.Course, b schedules.Course) bool {
+	length := len(a)
+	if len(b) > length {
+		length = len(b)
+	}
+
+	for i := 0; i < length; i++ {
+		var x, y *schedules.Time
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+
+		if (x == nil) != (y == nil) || (x != nil && *x != *y) {
+			return false
+		}
+	}
+	return true
+}
+
+func stopName(stop *common.Stop) string {
+	return fmt.Sprintf("%04d %s", stop.ID, stop.Name)
+}
+
+func lineName(line *common.Line) string {
+	return fmt.Sprintf("%s %s", line.Vehicle, line.Number)
+}
+
+func routeName(line *common.Line, direction string) string {
+	return fmt.Sprintf("%s (%s)", lineName(line), direction)
+}
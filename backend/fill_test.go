@@ -7,8 +7,8 @@ import (
 	"github.com/DexterLB/skgt_api/schedules"
 )
 
-func fillDatabase(t *testing.T) *Backend {
-	stops := []*common.Stop{
+func testStops() []*common.Stop {
+	return []*common.Stop{
 		&common.Stop{
 			ID:          1,
 			Name:        "foo",
@@ -31,11 +31,13 @@ func fillDatabase(t *testing.T) *Backend {
 			Longitude:  26,
 		},
 		&common.Stop{
-			ID:          4,
-			Name:        "qux",
-			Description: "Qux",
-			Latitude:    42,
-			Longitude:  26,
+			ID:                4,
+			Name:              "qux",
+			InternationalName: "Qux International",
+			CommunityName:     "Qux Community",
+			Description:       "Qux",
+			Latitude:          42,
+			Longitude:         26,
 		},
 		&common.Stop{
 			ID:          5,
@@ -73,7 +75,10 @@ func fillDatabase(t *testing.T) *Backend {
 			Longitude:  26,
 		},
 	}
-	timetables := []*schedules.Timetable{
+}
+
+func testTimetables() []*schedules.Timetable {
+	return []*schedules.Timetable{
 		&schedules.Timetable{
 			Line: &common.Line{
 				Vehicle: common.Tram,
@@ -164,10 +169,12 @@ func fillDatabase(t *testing.T) *Backend {
 			},
 		},
 	}
+}
 
+func fillDatabase(t *testing.T) *Backend {
 	backend := openBackend(t)
 
-	err := backend.Fill(stops, timetables)
+	_, err := backend.Fill(testStops(), testTimetables())
 	if err != nil {
 		t.Fatalf("unable to fill database: %s", err)
 	}
@@ -179,3 +186,143 @@ func TestBackend_Fill(t *testing.T) {
 	backend := fillDatabase(t)
 	defer closeBackend(t, backend)
 }
+
+func routeIDs(t *testing.T, backend *Backend) map[string]uint64 {
+	var rows []struct {
+		ID        uint64
+		Number    string
+		Direction string
+	}
+	err := backend.db.Select(
+		&rows,
+		`select route.id, line.number, route.direction from route
+		 left outer join line on line.id = route.line`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]uint64)
+	for _, row := range rows {
+		ids[row.Number+" "+row.Direction] = row.ID
+	}
+	return ids
+}
+
+func TestBackend_Fill_Incremental(t *testing.T) {
+	backend := fillDatabase(t)
+	defer closeBackend(t, backend)
+
+	oldIDs := routeIDs(t, backend)
+
+	summary, err := backend.Fill(testStops(), testTimetables())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualJSON(&UpdateSummary{Version: 1}, summary, t)
+	assertEqualJSON(oldIDs, routeIDs(t, backend), t)
+
+	var versions int
+	err = backend.db.Get(&versions, `select count(*) from dataset_version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versions != 1 {
+		t.Errorf("an update without changes created a dataset version")
+	}
+
+	stops := testStops()
+	stops[0].Name = "new foo"
+	stops = stops[:len(stops)-1]
+	stops = append(stops, &common.Stop{ID: 10, Name: "plugh"})
+
+	timetables := testTimetables()
+	// remove the "B - A" route of bus 94 (which uses stops 7, 8 and 9)
+	timetables[1].Routes = timetables[1].Routes[:1]
+	timetables[0].Routes[0].Schedules[schedules.Workday][1][2] = schedules.NewTime(14, 5)
+	timetables = append(timetables, &schedules.Timetable{
+		Line: &common.Line{
+			Vehicle: common.Trolley,
+			Number:  "2",
+		},
+		Routes: []*schedules.Route{
+			&schedules.Route{
+				Direction: "C - D",
+				Stops:     []int{10, 7, 8},
+				Schedules: map[schedules.ScheduleType][]schedules.Course{},
+			},
+		},
+	})
+
+	summary, err = backend.Fill(stops, timetables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &UpdateSummary{
+		Version: 2,
+		Lines: Changes{
+			Added:   []string{"Trolley 2"},
+			Changed: []string{"Bus 94", "Tram 10"},
+		},
+		Routes: Changes{
+			Added:   []string{"Trolley 2 (C - D)"},
+			Removed: []string{"Bus 94 (B - A)"},
+			Changed: []string{"Tram 10 (A - B)"},
+		},
+		Stops: Changes{
+			Added:   []string{"0010 plugh"},
+			Removed: []string{"0009 fred"},
+			Changed: []string{"0001 new foo"},
+		},
+	}
+
+	assertEqualJSON(expected, summary, t)
+
+	newIDs := routeIDs(t, backend)
+	for _, route := range []string{"10 A - B", "94 A - B"} {
+		if oldIDs[route] != newIDs[route] {
+			t.Errorf("ID of route %s changed from %d to %d", route, oldIDs[route], newIDs[route])
+		}
+	}
+}
+
+func TestBackend_Fill_DuplicateDirection(t *testing.T) {
+	backend := fillDatabase(t)
+	defer closeBackend(t, backend)
+
+	timetables := testTimetables()
+	duplicate := *timetables[0].Routes[0]
+	duplicate.Stops = []int{3, 2, 1}
+	timetables[0].Routes = append(timetables[0].Routes, &duplicate)
+
+	summary, err := backend.Fill(testStops(), timetables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualJSON(&UpdateSummary{
+		Version: 2,
+		Lines:   Changes{Changed: []string{lineName(timetables[0].Line)}},
+		Routes:  Changes{Added: []string{routeName(timetables[0].Line, duplicate.Direction)}},
+	}, summary, t)
+
+	var variants []int
+	err = backend.db.Select(
+		&variants,
+		`select variant from route where direction = $1 order by variant`,
+		duplicate.Direction,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualJSON([]int{0, 1}, variants, t)
+
+	// filling the same routes again finds both of them
+	summary, err = backend.Fill(testStops(), timetables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualJSON(&UpdateSummary{Version: 2}, summary, t)
+}
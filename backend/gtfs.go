@@ -0,0 +1,342 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/DexterLB/skgt_api/calendar"
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/gtfs"
+	"github.com/DexterLB/skgt_api/schedules"
+	"github.com/jmoiron/sqlx"
+)
+
+// ExportGTFS writes the whole database as a GTFS static feed (a zip file)
+// to w. All services in the feed are valid from start to end, and run on
+// the days of the week matching their day type, except for the dates on
+// which the calendar gives a different day type (e.g. public holidays).
+func (b *Backend) ExportGTFS(
+	w io.Writer, start time.Time, end time.Time, calendar *calendar.Calendar,
+) error {
+	feed := gtfs.NewWriter(w)
+
+	_, err := b.Wrap(func(tx *sqlx.Tx) (interface{}, error) {
+		steps := []struct {
+			name  string
+			write func(*sqlx.Tx, *gtfs.Writer) error
+		}{
+			{"agency", writeGTFSAgency},
+			{"stops", writeGTFSStops},
+			{"routes", writeGTFSRoutes},
+			{"trips", writeGTFSTrips},
+			{"stop times", writeGTFSStopTimes},
+			{"calendar", func(tx *sqlx.Tx, feed *gtfs.Writer) error {
+				return writeGTFSCalendar(tx, feed, start, end)
+			}},
+			{"calendar dates", func(tx *sqlx.Tx, feed *gtfs.Writer) error {
+				return writeGTFSCalendarDates(tx, feed, start, end, calendar)
+			}},
+		}
+
+		for _, step := range steps {
+			err := step.write(tx, feed)
+			if err != nil {
+				return nil, fmt.Errorf("unable to export %s: %s", step.name, err)
+			}
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return feed.Close()
+}
+
+func writeGTFSAgency(tx *sqlx.Tx, feed *gtfs.Writer) error {
+	f, err := feed.File(
+		"agency.txt",
+		"agency_id", "agency_name", "agency_url", "agency_timezone", "agency_lang",
+	)
+	if err != nil {
+		return err
+	}
+
+	return f.Write([]string{
+		gtfs.AgencyID, gtfs.AgencyName, gtfs.AgencyURL, gtfs.AgencyTimezone, gtfs.AgencyLang,
+	})
+}
+
+func writeGTFSStops(tx *sqlx.Tx, feed *gtfs.Writer) error {
+	var stops []*common.Stop
+	err := tx.Select(&stops, GET_ALL_STOPS)
+	if err != nil {
+		return fmt.Errorf("unable to select stops from db: %s", err)
+	}
+
+	f, err := feed.File(
+		"stops.txt",
+		"stop_id", "stop_code", "stop_name", "stop_desc", "stop_lat", "stop_lon",
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, stop := range stops {
+		err = f.Write([]string{
+			gtfs.StopID(stop.ID),
+			fmt.Sprintf("%04d", stop.ID),
+			stop.Name,
+			stop.Description,
+			strconv.FormatFloat(stop.Latitude, 'f', 6, 64),
+			strconv.FormatFloat(stop.Longitude, 'f', 6, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeGTFSRoutes(tx *sqlx.Tx, feed *gtfs.Writer) error {
+	var lines []*common.Line
+	err := tx.Select(&lines, GET_ALL_LINES)
+	if err != nil {
+		return fmt.Errorf("unable to select lines from db: %s", err)
+	}
+
+	f, err := feed.File(
+		"routes.txt",
+		"route_id", "agency_id", "route_short_name", "route_type",
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		err = f.Write([]string{
+			gtfs.RouteID(line),
+			gtfs.AgencyID,
+			line.Number,
+			strconv.Itoa(gtfs.RouteType(line.Vehicle)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeGTFSTrips(tx *sqlx.Tx, feed *gtfs.Writer) error {
+	rows, err := tx.Queryx(GET_GTFS_TRIPS)
+	if err != nil {
+		return fmt.Errorf("unable to select trips from db: %s", err)
+	}
+	defer rows.Close()
+
+	f, err := feed.File(
+		"trips.txt",
+		"route_id", "service_id", "trip_id", "trip_headsign",
+	)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var trip struct {
+			Route     uint64
+			DayType   schedules.ScheduleType
+			Course    int
+			Direction string
+			Vehicle   common.VehicleType
+			Number    string
+		}
+		err = rows.StructScan(&trip)
+		if err != nil {
+			return fmt.Errorf("unable to read trip: %s", err)
+		}
+
+		err = f.Write([]string{
+			gtfs.RouteID(&common.Line{Vehicle: trip.Vehicle, Number: trip.Number}),
+			gtfs.ServiceID(trip.DayType),
+			gtfs.TripID(trip.Route, trip.DayType, trip.Course),
+			trip.Direction,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func writeGTFSStopTimes(tx *sqlx.Tx, feed *gtfs.Writer) error {
+	rows, err := tx.Queryx(GET_GTFS_STOP_TIMES)
+	if err != nil {
+		return fmt.Errorf("unable to select stop times from db: %s", err)
+	}
+	defer rows.Close()
+
+	f, err := feed.File(
+		"stop_times.txt",
+		"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence",
+	)
+	if err != nil {
+		return err
+	}
+
+	// trips with a single stop time are not exported (see GET_GTFS_TRIPS),
+	// so stop times are buffered per trip and only written if there are
+	// at least two of them
+	var (
+		trip      [][]string
+		tripID    string
+		lastTime  int
+		dayOffset int
+	)
+
+	flush := func() error {
+		if len(trip) < 2 {
+			return nil
+		}
+		return f.WriteAll(trip)
+	}
+
+	for rows.Next() {
+		var stopTime struct {
+			Route   uint64
+			DayType schedules.ScheduleType
+			Course  int
+			Stop    int
+			Time    int
+			Index   int
+		}
+		err = rows.StructScan(&stopTime)
+		if err != nil {
+			return fmt.Errorf("unable to read stop time: %s", err)
+		}
+
+		id := gtfs.TripID(stopTime.Route, stopTime.DayType, stopTime.Course)
+		if id != tripID {
+			err = flush()
+			if err != nil {
+				return err
+			}
+			trip = nil
+			tripID = id
+			lastTime = 0
+			dayOffset = 0
+		}
+
+		// times in the database wrap around at midnight, while GTFS times
+		// must keep increasing within a trip
+		if stopTime.Time+dayOffset < lastTime {
+			dayOffset += 24 * 60
+		}
+		lastTime = stopTime.Time + dayOffset
+
+		trip = append(trip, []string{
+			tripID,
+			gtfs.FormatTime(lastTime),
+			gtfs.FormatTime(lastTime),
+			gtfs.StopID(stopTime.Stop),
+			strconv.Itoa(stopTime.Index),
+		})
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+func writeGTFSCalendar(tx *sqlx.Tx, feed *gtfs.Writer, start time.Time, end time.Time) error {
+	var dayTypes []schedules.ScheduleType
+	err := tx.Select(&dayTypes, GET_DAY_TYPES)
+	if err != nil {
+		return fmt.Errorf("unable to select day types from db: %s", err)
+	}
+
+	f, err := feed.File(
+		"calendar.txt",
+		"service_id",
+		"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday",
+		"start_date", "end_date",
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, dayType := range dayTypes {
+		record := []string{gtfs.ServiceID(dayType)}
+		for _, active := range gtfs.Weekdays(dayType) {
+			if active {
+				record = append(record, "1")
+			} else {
+				record = append(record, "0")
+			}
+		}
+		record = append(record, start.Format("20060102"), end.Format("20060102"))
+
+		err = f.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeGTFSCalendarDates adds and removes services on the dates whose day
+// type differs from the one usual for their day of the week
+func writeGTFSCalendarDates(
+	tx *sqlx.Tx, feed *gtfs.Writer, start time.Time, end time.Time, calendar *calendar.Calendar,
+) error {
+	var dayTypes []schedules.ScheduleType
+	err := tx.Select(&dayTypes, GET_DAY_TYPES)
+	if err != nil {
+		return fmt.Errorf("unable to select day types from db: %s", err)
+	}
+
+	f, err := feed.File("calendar_dates.txt", "service_id", "date", "exception_type")
+	if err != nil {
+		return err
+	}
+
+	for date := start; !date.After(end); date = date.AddDate(0, 0, 1) {
+		actual := calendar.DayType(date)
+		// calendar.txt starts from monday
+		weekday := (int(date.Weekday()) + 6) % 7
+
+		for _, dayType := range dayTypes {
+			usual := gtfs.Weekdays(dayType)[weekday]
+			runs := dayType&actual != 0
+			if usual == runs {
+				continue
+			}
+
+			exception := gtfs.ServiceRemoved
+			if runs {
+				exception = gtfs.ServiceAdded
+			}
+
+			err = f.Write([]string{
+				gtfs.ServiceID(dayType),
+				date.Format("20060102"),
+				strconv.Itoa(exception),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package backend
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/calendar"
+)
+
+func TestBackend_ExportGTFS(t *testing.T) {
+	backend := fillDatabase(t)
+	defer closeBackend(t, backend)
+
+	buf := &bytes.Buffer{}
+	err := backend.ExportGTFS(
+		buf,
+		time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2017, 12, 31, 0, 0, 0, 0, time.UTC),
+		calendar.New(nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// number of rows in each file, including the header
+	expected := map[string]int{
+		"agency.txt":     2,
+		"stops.txt":      10,
+		"routes.txt":     3,
+		"trips.txt":      10,
+		"stop_times.txt": 25,
+		"calendar.txt":   3,
+		// both services are swapped on the 12 holidays on workdays
+		"calendar_dates.txt": 25,
+	}
+
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		records, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			t.Fatalf("unable to read %s: %s", f.Name, err)
+		}
+
+		if len(records) != expected[f.Name] {
+			t.Errorf("%s has %d rows instead of %d", f.Name, len(records), expected[f.Name])
+		}
+		delete(expected, f.Name)
+	}
+
+	for name := range expected {
+		t.Errorf("%s is missing", name)
+	}
+}
@@ -0,0 +1,268 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/schedules"
+	"github.com/jmoiron/sqlx"
+)
+
+// ChangeKind is the kind of a timetable change
+type ChangeKind string
+
+const (
+	// LineAdded means that the line didn't exist before the update
+	LineAdded ChangeKind = "line_added"
+	// LineRemoved means that the line no longer exists
+	LineRemoved ChangeKind = "line_removed"
+	// RouteAdded means that the route is new, with NewStops as its stops
+	RouteAdded ChangeKind = "route_added"
+	// RouteRemoved means that the route no longer exists
+	RouteRemoved ChangeKind = "route_removed"
+	// StopsChanged means that the route's stops changed from OldStops
+	// to NewStops
+	StopsChanged ChangeKind = "stops_changed"
+	// CoursesChanged means that courses were added to or removed from
+	// the route, as listed in Courses
+	CoursesChanged ChangeKind = "courses_changed"
+)
+
+// TimetableChange is a single change to the timetable of a line, made by
+// an update. Direction is empty for changes to the line as a whole.
+type TimetableChange struct {
+	Version   uint64
+	Date      time.Time
+	Direction string
+	Kind      ChangeKind
+	changeDetails
+}
+
+// changeDetails contains the parts of a change which are stored as JSON
+type changeDetails struct {
+	OldStops []int            `json:",omitempty"`
+	NewStops []int            `json:",omitempty"`
+	Courses  []*CourseChanges `json:",omitempty"`
+}
+
+// CourseChanges lists the courses added and removed for a single day type.
+// Each course is given as the list of its times ("--:--" where the vehicle
+// doesn't stop).
+type CourseChanges struct {
+	DayType schedules.ScheduleType
+	Added   [][]string
+	Removed [][]string
+}
+
+// history collects the timetable changes made by an update
+type history struct {
+	changes []*lineChange
+}
+
+type lineChange struct {
+	line   common.Line
+	change *TimetableChange
+}
+
+func (h *history) record(line *common.Line, direction string, kind ChangeKind, details changeDetails) {
+	h.changes = append(h.changes, &lineChange{
+		line: *line,
+		change: &TimetableChange{
+			Direction:     direction,
+			Kind:          kind,
+			changeDetails: details,
+		},
+	})
+}
+
+// recordRoute records the differences between the old and new version of
+// a route
+func (h *history) recordRoute(line *common.Line, oldRoute *schedules.Route, route *schedules.Route) {
+	if !sameStopIDs(oldRoute.Stops, route.Stops) {
+		h.record(line, route.Direction, StopsChanged, changeDetails{
+			OldStops: oldRoute.Stops,
+			NewStops: route.Stops,
+		})
+	}
+
+	courses := courseChanges(oldRoute.Schedules, route.Schedules)
+	if len(courses) > 0 {
+		h.record(line, route.Direction, CoursesChanged, changeDetails{
+			Courses: courses,
+		})
+	}
+}
+
+// save stores the collected changes as a new dataset version, returning
+// its ID
+func (h *history) save(tx *sqlx.Tx) (uint64, error) {
+	var version uint64
+	err := tx.Get(&version, INSERT_DATASET_VERSION)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert dataset version: %s", err)
+	}
+
+	for _, lineChange := range h.changes {
+		details, err := json.Marshal(&lineChange.change.changeDetails)
+		if err != nil {
+			return 0, fmt.Errorf("unable to marshal change details: %s", err)
+		}
+
+		_, err = tx.Exec(
+			INSERT_TIMETABLE_CHANGE,
+			version,
+			lineChange.line.Vehicle,
+			lineChange.line.Number,
+			lineChange.change.Direction,
+			lineChange.change.Kind,
+			string(details),
+		)
+		if err != nil {
+			return 0, fmt.Errorf("unable to insert timetable change: %s", err)
+		}
+	}
+
+	return version, nil
+}
+
+// LineChanges returns the changes to the timetable of a line made by
+// updates since the given time. ErrNoSuchLine is returned if the line
+// neither exists nor has existed.
+func (b *Backend) LineChanges(
+	lineNumber string, vehicleType common.VehicleType, since time.Time,
+) ([]*TimetableChange, error) {
+	data, err := b.Wrap(func(tx *sqlx.Tx) (interface{}, error) {
+		var rows []struct {
+			Version   uint64
+			CreatedAt time.Time
+			Direction string
+			Kind      ChangeKind
+			Details   string
+		}
+
+		err := tx.Select(&rows, GET_CHANGES_FOR_LINE, lineNumber, vehicleType, since)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"unable to select changes for line %s of type %s from db: %s",
+				lineNumber, vehicleType, err,
+			)
+		}
+
+		if len(rows) == 0 {
+			var exists bool
+			err = tx.Get(&exists, LINE_EXISTS, lineNumber, vehicleType)
+			if err != nil {
+				return nil, fmt.Errorf("unable to check if line exists: %s", err)
+			}
+			if !exists {
+				return nil, ErrNoSuchLine
+			}
+		}
+
+		changes := make([]*TimetableChange, len(rows))
+		for i, row := range rows {
+			changes[i] = &TimetableChange{
+				Version:   row.Version,
+				Date:      row.CreatedAt,
+				Direction: row.Direction,
+				Kind:      row.Kind,
+			}
+
+			err = json.Unmarshal([]byte(row.Details), &changes[i].changeDetails)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse change details: %s", err)
+			}
+		}
+
+		return changes, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data.([]*TimetableChange), nil
+}
+
+// courseChanges compares the courses of two schedules. Courses are
+// identified by their times, so reordering them is not a change.
+func courseChanges(
+	before map[schedules.ScheduleType][]schedules.Course,
+	after map[schedules.ScheduleType][]schedules.Course,
+) []*CourseChanges {
+	var dayTypes []schedules.ScheduleType
+	for dayType := range before {
+		dayTypes = append(dayTypes, dayType)
+	}
+	for dayType := range after {
+		if _, ok := before[dayType]; !ok {
+			dayTypes = append(dayTypes, dayType)
+		}
+	}
+	sort.Slice(dayTypes, func(i, j int) bool { return dayTypes[i] < dayTypes[j] })
+
+	var changes []*CourseChanges
+	for _, dayType := range dayTypes {
+		added, removed := diffCourses(before[dayType], after[dayType])
+		if len(added) > 0 || len(removed) > 0 {
+			changes = append(changes, &CourseChanges{
+				DayType: dayType,
+				Added:   added,
+				Removed: removed,
+			})
+		}
+	}
+
+	return changes
+}
+
+// diffCourses returns the courses which appear more times in after than
+// in before (added) and vice versa (removed)
+func diffCourses(before []schedules.Course, after []schedules.Course) ([][]string, [][]string) {
+	counts := make(map[string]int)
+	for _, course := range before {
+		counts[courseKey(course)]--
+	}
+	for _, course := range after {
+		counts[courseKey(course)]++
+	}
+
+	var added, removed [][]string
+	for _, course := range after {
+		key := courseKey(course)
+		if counts[key] > 0 {
+			counts[key]--
+			added = append(added, courseTimes(course))
+		}
+	}
+	for _, course := range before {
+		key := courseKey(course)
+		if counts[key] < 0 {
+			counts[key]++
+			removed = append(removed, courseTimes(course))
+		}
+	}
+
+	return added, removed
+}
+
+// courseKey is a string which is the same for courses considered equal by
+// sameCourse
+func courseKey(course schedules.Course) string {
+	return strings.TrimRight(strings.Join(courseTimes(course), " "), " -:")
+}
+
+func courseTimes(course schedules.Course) []string {
+	times := make([]string, len(course))
+	for i, arrival := range course {
+		if arrival == nil {
+			times[i] = "--:--"
+		} else {
+			times[i] = fmt.Sprintf("%02d:%02d", arrival.Hours, arrival.Minutes)
+		}
+	}
+	return times
+}
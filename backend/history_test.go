@@ -0,0 +1,113 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/schedules"
+)
+
+func TestBackend_LineChanges(t *testing.T) {
+	backend := fillDatabase(t)
+	defer closeBackend(t, backend)
+
+	timetables := testTimetables()
+	timetables[0].Routes[0].Schedules[schedules.Workday][1][2] = schedules.NewTime(14, 5)
+	timetables[1].Routes[1].Stops = []int{7, 9}
+
+	_, err := backend.Fill(testStops(), timetables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := backend.LineChanges("10", common.Tram, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range changes {
+		change.Date = time.Time{}
+	}
+
+	expected := []*TimetableChange{
+		&TimetableChange{
+			Version: 1,
+			Kind:    LineAdded,
+		},
+		&TimetableChange{
+			Version:   1,
+			Direction: "A - B",
+			Kind:      RouteAdded,
+			changeDetails: changeDetails{
+				NewStops: []int{1, 2, 3},
+			},
+		},
+		&TimetableChange{
+			Version:   2,
+			Direction: "A - B",
+			Kind:      CoursesChanged,
+			changeDetails: changeDetails{
+				Courses: []*CourseChanges{
+					&CourseChanges{
+						DayType: schedules.Workday,
+						Added:   [][]string{{"13:00", "13:30", "14:05"}},
+						Removed: [][]string{{"13:00", "13:30", "14:00"}},
+					},
+				},
+			},
+		},
+	}
+
+	assertEqualJSON(expected, changes, t)
+
+	changes, err = backend.LineChanges("94", common.Bus, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) == 0 {
+		t.Fatalf("no changes for line 94")
+	}
+
+	last := changes[len(changes)-1]
+	last.Date = time.Time{}
+
+	assertEqualJSON(&TimetableChange{
+		Version:   2,
+		Direction: "B - A",
+		Kind:      StopsChanged,
+		changeDetails: changeDetails{
+			OldStops: []int{7, 8, 9},
+			NewStops: []int{7, 9},
+		},
+	}, last, t)
+
+	changes, err = backend.LineChanges("94", common.Bus, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 0 {
+		t.Errorf("expected no changes in the future, got %d", len(changes))
+	}
+}
+
+func TestDiffCourses(t *testing.T) {
+	before := []schedules.Course{
+		schedules.Course{schedules.NewTime(10, 0), schedules.NewTime(10, 5)},
+		schedules.Course{schedules.NewTime(11, 0), schedules.NewTime(11, 5)},
+		schedules.Course{schedules.NewTime(11, 0), schedules.NewTime(11, 5)},
+		schedules.Course{schedules.NewTime(12, 0), nil},
+	}
+	after := []schedules.Course{
+		schedules.Course{schedules.NewTime(11, 0), schedules.NewTime(11, 5)},
+		schedules.Course{schedules.NewTime(12, 0)},
+		schedules.Course{schedules.NewTime(10, 0), schedules.NewTime(10, 5)},
+		schedules.Course{schedules.NewTime(13, 0), nil},
+	}
+
+	added, removed := diffCourses(before, after)
+
+	assertEqualJSON([][]string{{"13:00", "--:--"}}, added, t)
+	assertEqualJSON([][]string{{"11:00", "11:05"}}, removed, t)
+}
@@ -0,0 +1,251 @@
+package backend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migration is a single change of the database schema. The schema version
+// of a database is the number of migrations applied to it.
+type migration struct {
+	description string
+	up          string
+	down        string
+	// upFunc is run after up, for changes which can't be done in SQL
+	upFunc func(tx *sqlx.Tx) error
+}
+
+// MigrationStatus describes a migration and whether it has been applied
+type MigrationStatus struct {
+	Version     int
+	Description string
+	AppliedAt   *time.Time
+}
+
+// LatestSchemaVersion returns the schema version this version of the API
+// works with
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+// SchemaVersion returns the current schema version of the database
+func (b *Backend) SchemaVersion() (int, error) {
+	data, err := b.Wrap(func(tx *sqlx.Tx) (interface{}, error) {
+		return schemaVersion(tx)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return data.(int), nil
+}
+
+// CheckSchemaVersion returns an error if the schema version of the database
+// is not the one this version of the API works with
+func (b *Backend) CheckSchemaVersion() error {
+	version, err := b.SchemaVersion()
+	if err != nil {
+		return fmt.Errorf("unable to get schema version: %s", err)
+	}
+
+	switch {
+	case version > LatestSchemaVersion():
+		return fmt.Errorf(
+			"unknown schema version %d (latest known is %d), is the API outdated?",
+			version, LatestSchemaVersion(),
+		)
+	case version < LatestSchemaVersion():
+		return fmt.Errorf(
+			"schema version %d is outdated (latest is %d), please migrate the database",
+			version, LatestSchemaVersion(),
+		)
+	default:
+		return nil
+	}
+}
+
+// Migrate applies or reverts migrations until the schema reaches the target
+// version. All migrations are performed in a single transaction.
+func (b *Backend) Migrate(target int) error {
+	if target < 0 || target > LatestSchemaVersion() {
+		return fmt.Errorf(
+			"unknown schema version %d (latest known is %d)",
+			target, LatestSchemaVersion(),
+		)
+	}
+
+	_, err := b.Wrap(func(tx *sqlx.Tx) (interface{}, error) {
+		err := trackMigrations(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		version, err := schemaVersion(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		if version > LatestSchemaVersion() {
+			return nil, fmt.Errorf(
+				"unknown schema version %d (latest known is %d)",
+				version, LatestSchemaVersion(),
+			)
+		}
+
+		for ; version < target; version++ {
+			m := migrations[version]
+			_, err = tx.Exec(m.up)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"unable to apply migration %d (%s): %s",
+					version+1, m.description, err,
+				)
+			}
+
+			if m.upFunc != nil {
+				err = m.upFunc(tx)
+				if err != nil {
+					return nil, fmt.Errorf(
+						"unable to apply migration %d (%s): %s",
+						version+1, m.description, err,
+					)
+				}
+			}
+
+			_, err = tx.Exec(INSERT_MIGRATION, version+1, m.description)
+			if err != nil {
+				return nil, fmt.Errorf("unable to record migration %d: %s", version+1, err)
+			}
+		}
+
+		for ; version > target; version-- {
+			m := migrations[version-1]
+			_, err = tx.Exec(m.down)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"unable to revert migration %d (%s): %s",
+					version, m.description, err,
+				)
+			}
+
+			_, err = tx.Exec(DELETE_MIGRATION, version)
+			if err != nil {
+				return nil, fmt.Errorf("unable to record migration %d: %s", version, err)
+			}
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+// MigrationStatus returns all known migrations and when they were applied
+func (b *Backend) MigrationStatus() ([]*MigrationStatus, error) {
+	data, err := b.Wrap(func(tx *sqlx.Tx) (interface{}, error) {
+		tracked, err := tableExists(tx, "schema_migration")
+		if err != nil {
+			return nil, err
+		}
+
+		var applied []struct {
+			Version   int
+			AppliedAt *time.Time
+		}
+		if tracked {
+			err = tx.Select(&applied, GET_APPLIED_MIGRATIONS)
+			if err != nil {
+				return nil, fmt.Errorf("unable to select applied migrations: %s", err)
+			}
+		}
+
+		status := make([]*MigrationStatus, len(migrations))
+		for i := range migrations {
+			status[i] = &MigrationStatus{
+				Version:     i + 1,
+				Description: migrations[i].description,
+			}
+		}
+
+		for _, m := range applied {
+			if m.Version <= len(status) {
+				status[m.Version-1].AppliedAt = m.AppliedAt
+			}
+		}
+
+		return status, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data.([]*MigrationStatus), nil
+}
+
+// schemaVersion returns the current schema version without changing the
+// database. Databases created before migrations were introduced (which have
+// no migrations table) are considered to be at version 1.
+func schemaVersion(tx *sqlx.Tx) (int, error) {
+	tracked, err := tableExists(tx, "schema_migration")
+	if err != nil {
+		return 0, err
+	}
+
+	if !tracked {
+		legacy, err := tableExists(tx, "stop")
+		if err != nil {
+			return 0, err
+		}
+		if legacy {
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	var version int
+	err = tx.Get(&version, GET_SCHEMA_VERSION)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get schema version: %s", err)
+	}
+
+	return version, nil
+}
+
+// trackMigrations creates the migrations table if it doesn't exist,
+// recording databases created before migrations as being at version 1
+func trackMigrations(tx *sqlx.Tx) error {
+	version, err := schemaVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	tracked, err := tableExists(tx, "schema_migration")
+	if err != nil || tracked {
+		return err
+	}
+
+	_, err = tx.Exec(CREATE_MIGRATIONS_TABLE)
+	if err != nil {
+		return fmt.Errorf("unable to create migrations table: %s", err)
+	}
+
+	if version == 1 {
+		_, err = tx.Exec(INSERT_MIGRATION, 1, migrations[0].description)
+		if err != nil {
+			return fmt.Errorf("unable to record existing schema: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func tableExists(tx *sqlx.Tx, table string) (bool, error) {
+	var exists bool
+	err := tx.Get(&exists, TABLE_EXISTS, table)
+	if err != nil {
+		return false, fmt.Errorf("unable to check for table %s: %s", table, err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,213 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/DexterLB/skgt_api/common"
+)
+
+func TestBackend_Migrate(t *testing.T) {
+	backend := openBackend(t)
+	defer closeBackend(t, backend)
+
+	err := backend.CheckSchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []int{0, LatestSchemaVersion(), 1, LatestSchemaVersion()} {
+		err = backend.Migrate(target)
+		if err != nil {
+			t.Fatalf("unable to migrate to %d: %s", target, err)
+		}
+
+		version, err := backend.SchemaVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if version != target {
+			t.Errorf("schema version is %d after migrating to %d", version, target)
+		}
+	}
+
+	status, err := backend.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status) != LatestSchemaVersion() {
+		t.Fatalf("status has %d migrations instead of %d", len(status), LatestSchemaVersion())
+	}
+
+	for _, migration := range status {
+		if migration.AppliedAt == nil {
+			t.Errorf("migration %d is not applied", migration.Version)
+		}
+	}
+
+	err = backend.Migrate(LatestSchemaVersion() + 1)
+	if err == nil {
+		t.Errorf("no error when migrating to an unknown version")
+	}
+}
+
+func TestBackend_Migrate_HashAPIKeys(t *testing.T) {
+	backend := openBackend(t)
+	defer closeBackend(t, backend)
+
+	err := backend.Migrate(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiKey, err := generateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = backend.db.Exec("insert into api_key(value, label) values($1, 'old')", apiKey)
+	if err != nil {
+		t.Fatalf("unable to insert plaintext api key: %s", err)
+	}
+
+	err = backend.Migrate(LatestSchemaVersion())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := backend.CheckAPIKey(apiKey)
+	if err != nil {
+		t.Fatalf("plaintext api key is not valid after migration: %s", err)
+	}
+	if key.Label != "old" || key.Prefix != apiKey[:apiKeyPrefixLength] {
+		t.Errorf("wrong api key after migration: %+v", key)
+	}
+}
+
+func TestBackend_Migrate_StopNames(t *testing.T) {
+	backend := openBackend(t)
+	defer closeBackend(t, backend)
+
+	err := backend.Migrate(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = backend.db.Exec("insert into stop(id, name, description) values(1, 'foo', 'FOO')")
+	if err != nil {
+		t.Fatalf("unable to insert stop: %s", err)
+	}
+
+	err = backend.Migrate(LatestSchemaVersion())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stops []*common.Stop
+	err = backend.db.Select(&stops, GET_ALL_STOPS)
+	if err != nil {
+		t.Fatalf("unable to select stops after migration: %s", err)
+	}
+
+	if len(stops) != 1 || stops[0].Name != "foo" || stops[0].InternationalName != "" {
+		t.Errorf("wrong stops after migration: %+v", stops)
+	}
+}
+
+func TestBackend_Migrate_DuplicateRoutes(t *testing.T) {
+	backend := openBackend(t)
+	defer closeBackend(t, backend)
+
+	err := backend.Migrate(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = backend.db.Exec(`
+		insert into stop(id, name) values(1, 'foo');
+		insert into line(id, vehicle, number) values(1, 1, '10');
+		insert into route(id, line, direction) values(1, 1, 'A - B'), (2, 1, 'A - B');
+		insert into route_stop(route, index, stop) values(1, 1, 1), (2, 1, 1);
+		insert into arrival(route, stop, course, time, day_type) values(2, 1, 1, 720, 1);
+	`)
+	if err != nil {
+		t.Fatalf("unable to insert duplicate routes: %s", err)
+	}
+
+	err = backend.Migrate(LatestSchemaVersion())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var variants []int
+	err = backend.db.Select(&variants, "select variant from route order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualJSON([]int{0, 1}, variants, t)
+
+	var arrivals int
+	err = backend.db.Get(&arrivals, "select count(*) from arrival where route = 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arrivals != 1 {
+		t.Errorf("the migration removed arrivals of the second route")
+	}
+}
+
+func TestBackend_Migrate_DuplicateLines(t *testing.T) {
+	backend := openBackend(t)
+	defer closeBackend(t, backend)
+
+	err := backend.Migrate(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = backend.db.Exec(`
+		insert into line(id, vehicle, number) values(1, 1, '10'), (2, 1, '10');
+	`)
+	if err != nil {
+		t.Fatalf("unable to insert duplicate lines: %s", err)
+	}
+
+	err = backend.Migrate(LatestSchemaVersion())
+	if err == nil {
+		t.Errorf("no error for duplicate lines")
+	}
+
+	var lines int
+	err = backend.db.Get(&lines, "select count(*) from line")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines != 2 {
+		t.Errorf("the failed migration removed lines")
+	}
+}
+
+func TestBackend_CheckSchemaVersion_ReadOnly(t *testing.T) {
+	backend := openBackend(t)
+	defer closeBackend(t, backend)
+
+	err := backend.DropDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = backend.CheckSchemaVersion()
+	if err == nil {
+		t.Errorf("no error for an empty database")
+	}
+
+	var tracked bool
+	err = backend.db.Get(&tracked, TABLE_EXISTS, "schema_migration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracked {
+		t.Errorf("checking the schema version created the migrations table")
+	}
+}
@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/gtfs"
+	"github.com/DexterLB/skgt_api/planner"
+	"github.com/DexterLB/skgt_api/schedules"
+	"github.com/jmoiron/sqlx"
+)
+
+// Planner loads the timetable for the given day type into a journey planner
+func (b *Backend) Planner(dayType schedules.ScheduleType) (*planner.Planner, error) {
+	data, err := b.Wrap(func(tx *sqlx.Tx) (interface{}, error) {
+		var stops []*common.Stop
+		err := tx.Select(&stops, GET_ALL_STOPS)
+		if err != nil {
+			return nil, fmt.Errorf("unable to select stops from db: %s", err)
+		}
+
+		connections, err := plannerConnections(tx, dayType)
+		if err != nil {
+			return nil, err
+		}
+
+		return planner.New(stops, connections), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data.(*planner.Planner), nil
+}
+
+// plannerConnections returns the connections between consecutive stops of
+// all courses valid for the day type
+func plannerConnections(tx *sqlx.Tx, dayType schedules.ScheduleType) ([]*planner.Connection, error) {
+	rows, err := tx.Queryx(GET_PLANNER_STOP_TIMES, dayType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to select stop times from db: %s", err)
+	}
+	defer rows.Close()
+
+	var (
+		connections []*planner.Connection
+		tripID      string
+		lastStop    int
+		lastTime    int
+		dayOffset   int
+	)
+
+	for rows.Next() {
+		var stopTime struct {
+			Route     uint64
+			DayType   schedules.ScheduleType
+			Course    int
+			Stop      int
+			Time      int
+			Direction string
+			Vehicle   common.VehicleType
+			Number    string
+		}
+		err = rows.StructScan(&stopTime)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read stop time: %s", err)
+		}
+
+		id := gtfs.TripID(stopTime.Route, stopTime.DayType, stopTime.Course)
+		if id != tripID {
+			tripID = id
+			lastStop = stopTime.Stop
+			lastTime = stopTime.Time
+			dayOffset = 0
+			continue
+		}
+
+		// times in the database wrap around at midnight, while the
+		// planner's times must keep increasing within a trip
+		if stopTime.Time+dayOffset < lastTime {
+			dayOffset += 24 * 60
+		}
+
+		connections = append(connections, &planner.Connection{
+			TripID: tripID,
+			Line: common.Line{
+				Vehicle: stopTime.Vehicle,
+				Number:  stopTime.Number,
+			},
+			Direction: stopTime.Direction,
+			From:      lastStop,
+			To:        stopTime.Stop,
+			Departure: lastTime,
+			Arrival:   stopTime.Time + dayOffset,
+		})
+
+		lastStop = stopTime.Stop
+		lastTime = stopTime.Time + dayOffset
+	}
+
+	return connections, rows.Err()
+}
@@ -0,0 +1,46 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/planner"
+	"github.com/DexterLB/skgt_api/schedules"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackend_Planner(t *testing.T) {
+	assert := assert.New(t)
+	backend := fillDatabase(t)
+	defer closeBackend(t, backend)
+
+	for dayType, count := range map[schedules.ScheduleType]int{
+		schedules.Workday: 12,
+		schedules.Holiday: 3,
+	} {
+		data, err := backend.Wrap(func(tx *sqlx.Tx) (interface{}, error) {
+			return plannerConnections(tx, dayType)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(count, len(data.([]*planner.Connection)), "for %s", dayType)
+	}
+
+	p, err := backend.Planner(schedules.Workday)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(p.HasStop(1))
+
+	itineraries := p.Plan(1, 3, 11*60+50, 180, 1)
+	if assert.Equal(1, len(itineraries)) {
+		legs := itineraries[0].Legs
+		// all test stops are at the same place, so walking is fastest
+		assert.Equal(1, len(legs))
+		assert.Equal((*common.Line)(nil), legs[0].Line)
+	}
+}
@@ -0,0 +1,161 @@
+package backend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DexterLB/skgt_api/calendar"
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/delays"
+	"github.com/DexterLB/skgt_api/realtime"
+	"github.com/DexterLB/skgt_api/schedules"
+	"github.com/jmoiron/sqlx"
+)
+
+// Arrivals which are at most OnTimeEarliness minutes early and at most
+// OnTimeLateness minutes late are considered on time
+const (
+	OnTimeEarliness = 1
+	OnTimeLateness  = 3
+)
+
+// Punctuality summarises the arrivals of a line at a stop in an hour of
+// the day (according to the schedule)
+type Punctuality struct {
+	Stop         int
+	Hour         int
+	Arrivals     int
+	AverageDelay float64 // in minutes
+	OnTime       int
+}
+
+// StoreArrivals adds predicted arrivals at a stop to the arrival history.
+// Predictions which are already stored are skipped.
+func (b *Backend) StoreArrivals(stopID int, arrivals []*realtime.LineArrivals) error {
+	_, err := b.Wrap(func(tx *sqlx.Tx) (interface{}, error) {
+		for _, lineArrivals := range arrivals {
+			for _, arrival := range lineArrivals.Arrivals {
+				_, err := tx.Exec(
+					INSERT_ARRIVAL_HISTORY,
+					stopID, lineArrivals.Line.Vehicle, lineArrivals.Line.Number,
+					arrival.Time, arrival.Calculated,
+					arrival.ScheduledTime, arrival.DelayMinutes,
+					arrival.AirConditioning, arrival.Accessibility,
+				)
+				if err != nil {
+					return nil, fmt.Errorf("unable to insert arrival: %s", err)
+				}
+			}
+		}
+		return nil, nil
+	})
+
+	return err
+}
+
+// Punctuality returns the punctuality of a line per stop and hour for the
+// arrivals scheduled between from and to. If stopID is not nil, only that
+// stop is included. Only arrivals which have been matched to the schedule
+// are counted.
+func (b *Backend) Punctuality(
+	number string, vehicle common.VehicleType, stopID *int, from time.Time, to time.Time,
+) ([]*Punctuality, error) {
+	punctuality := []*Punctuality{}
+	err := b.db.Select(
+		&punctuality, GET_PUNCTUALITY,
+		number, vehicle, from, to, stopID, -OnTimeEarliness, OnTimeLateness,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to select punctuality: %s", err)
+	}
+
+	if len(punctuality) == 0 {
+		var exists bool
+		err = b.db.Get(&exists, LINE_EXISTS, number, vehicle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to check if line exists: %s", err)
+		}
+		if !exists {
+			return nil, ErrNoSuchLine
+		}
+	}
+
+	return punctuality, nil
+}
+
+// StopTimes returns the stop times at the given stop on the service days
+// which may have courses running at now: the previous one (for courses
+// past midnight) and the current one. The day type of each service day is
+// taken from the calendar, and the dates are in the location of now.
+func (b *Backend) StopTimes(
+	stopID int, now time.Time, calendar *calendar.Calendar,
+) ([]*delays.StopTime, error) {
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+
+	var stopTimes []*delays.StopTime
+	for _, date := range []time.Time{today.AddDate(0, 0, -1), today} {
+		dayStopTimes, err := b.serviceDayStopTimes(stopID, date, calendar.DayType(date))
+		if err != nil {
+			return nil, err
+		}
+		stopTimes = append(stopTimes, dayStopTimes...)
+	}
+
+	return stopTimes, nil
+}
+
+// serviceDayStopTimes returns the stop times at the given stop on a single
+// service day
+func (b *Backend) serviceDayStopTimes(
+	stopID int, date time.Time, dayType schedules.ScheduleType,
+) ([]*delays.StopTime, error) {
+	var rows []struct {
+		Route     uint64
+		DayType   schedules.ScheduleType
+		Course    int
+		Time      *schedules.Time
+		Index     int
+		Vehicle   common.VehicleType
+		Number    string
+		StartTime *schedules.Time
+	}
+
+	err := b.db.Select(&rows, GET_STOP_TIMES_FOR_STOP, stopID, dayType)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"unable to select stop times for stop %d from db: %s",
+			stopID, err,
+		)
+	}
+
+	stopTimes := make([]*delays.StopTime, len(rows))
+	for i, row := range rows {
+		// times wrap at midnight, so a course which arrives earlier than
+		// it has started has passed midnight
+		dayOffset := 0
+		if row.StartTime != nil &&
+			row.Time.Hours*60+row.Time.Minutes < row.StartTime.Hours*60+row.StartTime.Minutes {
+			dayOffset = 1
+		}
+
+		stopTimes[i] = &delays.StopTime{
+			Route:   row.Route,
+			DayType: row.DayType,
+			Course:  row.Course,
+			Line: common.Line{
+				Vehicle: row.Vehicle,
+				Number:  row.Number,
+			},
+			StopID:       stopID,
+			StopSequence: row.Index,
+			ServiceDate:  date,
+			Scheduled: time.Date(
+				date.Year(), date.Month(), date.Day()+dayOffset,
+				row.Time.Hours, row.Time.Minutes, 0, 0, date.Location(),
+			),
+		}
+	}
+
+	return stopTimes, nil
+}
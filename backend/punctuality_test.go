@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/calendar"
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/realtime"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackend_Punctuality(t *testing.T) {
+	assert := assert.New(t)
+	backend := fillDatabase(t)
+	defer closeBackend(t, backend)
+
+	location, _ := time.LoadLocation("Europe/Sofia")
+	scheduled := time.Date(2017, 3, 1, 12, 30, 0, 0, location)
+	line := &common.Line{Vehicle: common.Bus, Number: "94"}
+
+	arrival := func(minutesLate int, calculatedBefore time.Duration) *realtime.Arrival {
+		arrivalTime := scheduled.Add(time.Duration(minutesLate) * time.Minute)
+		return &realtime.Arrival{
+			Time:          arrivalTime,
+			Calculated:    arrivalTime.Add(-calculatedBefore),
+			ScheduledTime: &scheduled,
+			DelayMinutes:  &minutesLate,
+		}
+	}
+
+	// the later prediction of the same arrival replaces the earlier one
+	for _, arrivals := range [][]*realtime.Arrival{
+		{arrival(10, 20*time.Minute)},
+		{arrival(2, 5*time.Minute)},
+		{arrival(2, 5*time.Minute)},
+		// not matched to the schedule
+		{{Time: scheduled, Calculated: scheduled.Add(-time.Minute)}},
+	} {
+		err := backend.StoreArrivals(1, []*realtime.LineArrivals{
+			{Line: line, Arrivals: arrivals},
+		})
+		if err != nil {
+			t.Fatalf("cannot store arrivals: %s", err)
+		}
+	}
+
+	punctuality, err := backend.Punctuality(
+		"94", common.Bus, nil, scheduled.AddDate(0, 0, -1), scheduled.AddDate(0, 0, 1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal([]*Punctuality{
+		{Stop: 1, Hour: 12, Arrivals: 1, AverageDelay: 2, OnTime: 1},
+	}, punctuality)
+
+	otherStop := 2
+	punctuality, err = backend.Punctuality(
+		"94", common.Bus, &otherStop, scheduled.AddDate(0, 0, -1), scheduled.AddDate(0, 0, 1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal([]*Punctuality{}, punctuality)
+
+	_, err = backend.Punctuality("1000", common.Bus, nil, scheduled, scheduled)
+	if err != ErrNoSuchLine {
+		t.Errorf("wrong error for unknown line: %v", err)
+	}
+}
+
+func TestBackend_StopTimes(t *testing.T) {
+	backend := fillDatabase(t)
+	defer closeBackend(t, backend)
+
+	// a monday, so the previous service day is a holiday
+	now := time.Date(2017, 3, 13, 10, 0, 0, 0, time.UTC)
+	stopTimes, err := backend.StopTimes(2, now, calendar.New(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scheduled []time.Time
+	for _, stopTime := range stopTimes {
+		scheduled = append(scheduled, stopTime.Scheduled)
+	}
+
+	assert.New(t).Equal([]time.Time{
+		time.Date(2017, 3, 12, 14, 30, 0, 0, time.UTC),
+		time.Date(2017, 3, 13, 12, 30, 0, 0, time.UTC),
+		time.Date(2017, 3, 13, 13, 30, 0, 0, time.UTC),
+	}, scheduled)
+}
@@ -18,4 +18,269 @@ const (
 		where r.route = $1
 		order by r.index;
 	`
+
+	GET_SCHEDULED_ARRIVALS_FOR_STOP = `
+		select line.vehicle, line.number, route.direction,
+			arrival.course, arrival.time, arrival.day_type as dayType
+		from arrival
+		left outer join route on route.id = arrival.route
+		left outer join line on line.id = route.line
+		where arrival.stop = $1
+			and arrival.day_type & $2 != 0
+			and arrival.time between $3 and $4
+		order by line.vehicle, line.number, route.direction, arrival.time;
+	`
+
+	STOP_EXISTS = `
+		select exists(select 1 from stop where id = $1);
+	`
+
+	LINE_EXISTS = `
+		select exists(select 1 from line where number = $1 and vehicle = $2)
+			or exists(select 1 from timetable_change where number = $1 and vehicle = $2);
+	`
+
+	GET_ALL_STOPS = `
+		select * from stop
+		order by id;
+	`
+
+	GET_DAY_TYPES = `
+		select distinct day_type from arrival
+		order by day_type;
+	`
+
+	GET_GTFS_TRIPS = `
+		select arrival.route, arrival.day_type as dayType, arrival.course,
+			route.direction, line.vehicle, line.number
+		from arrival
+		left outer join route on route.id = arrival.route
+		left outer join line on line.id = route.line
+		group by arrival.route, arrival.day_type, arrival.course,
+			route.direction, line.vehicle, line.number
+		having count(arrival.time) >= 2
+		order by arrival.route, arrival.day_type, arrival.course;
+	`
+
+	GET_GTFS_STOP_TIMES = `
+		select arrival.route, arrival.day_type as dayType, arrival.course,
+			arrival.stop, arrival.time, route_stop.index
+		from arrival
+		left outer join route_stop on route_stop.route = arrival.route
+			and route_stop.stop = arrival.stop
+		where arrival.time is not null
+		order by arrival.route, arrival.day_type, arrival.course, route_stop.index;
+	`
+
+	GET_STOP_TIMES_FOR_STOP = `
+		select arrival.route, arrival.day_type as dayType, arrival.course,
+			arrival.time, route_stop.index, line.vehicle, line.number,
+			(
+				select first.time from arrival as first
+				left outer join route_stop as first_stop
+					on first_stop.route = first.route
+					and first_stop.stop = first.stop
+				where first.route = arrival.route
+					and first.day_type = arrival.day_type
+					and first.course = arrival.course
+					and first.time is not null
+				order by first_stop.index
+				limit 1
+			) as startTime
+		from arrival
+		left outer join route_stop on route_stop.route = arrival.route
+			and route_stop.stop = arrival.stop
+		left outer join route on route.id = arrival.route
+		left outer join line on line.id = route.line
+		where arrival.stop = $1
+			and arrival.day_type & $2 != 0
+			and arrival.time is not null
+		order by arrival.time;
+	`
+
+	GET_PLANNER_STOP_TIMES = `
+		select arrival.route, arrival.day_type as dayType, arrival.course,
+			arrival.stop, arrival.time, route.direction, line.vehicle, line.number
+		from arrival
+		left outer join route_stop on route_stop.route = arrival.route
+			and route_stop.stop = arrival.stop
+		left outer join route on route.id = arrival.route
+		left outer join line on line.id = route.line
+		where arrival.day_type & $1 != 0
+			and arrival.time is not null
+		order by arrival.route, arrival.day_type, arrival.course, route_stop.index;
+	`
+
+	GET_NEARBY_STOPS = `
+		select * from (
+			select stop.*, 2 * 6371000 * asin(sqrt(
+				power(sin(radians(latitude - $1) / 2), 2) +
+				cos(radians($1)) * cos(radians(latitude)) *
+				power(sin(radians(longitude - $2) / 2), 2)
+			)) as distance
+			from stop
+			where latitude != 0 or longitude != 0
+		) as stop_distance
+		where distance <= $3
+		order by distance, id
+		limit $4;
+	`
+
+	GET_LINES_FOR_STOPS = `
+		select distinct route_stop.stop, line.vehicle, line.number
+		from route_stop
+		left outer join route on route.id = route_stop.route
+		left outer join line on line.id = route.line
+		where route_stop.stop = any($1)
+		order by route_stop.stop, line.vehicle, line.number;
+	`
+
+	CREATE_MIGRATIONS_TABLE = `
+		create table if not exists schema_migration(
+			version int primary key,
+			description varchar(1024),
+			applied_at timestamp with time zone default now()
+		);
+	`
+
+	DROP_MIGRATIONS_TABLE = `
+		drop table if exists schema_migration;
+	`
+
+	GET_SCHEMA_VERSION = `
+		select coalesce(max(version), 0) from schema_migration;
+	`
+
+	GET_APPLIED_MIGRATIONS = `
+		select version, applied_at as appliedAt from schema_migration
+		order by version;
+	`
+
+	INSERT_MIGRATION = `
+		insert into schema_migration(version, description)
+		values($1, $2);
+	`
+
+	DELETE_MIGRATION = `
+		delete from schema_migration where version = $1;
+	`
+
+	TABLE_EXISTS = `
+		select to_regclass($1) is not null;
+	`
+
+	GET_LATEST_DATASET_VERSION = `
+		select coalesce(max(id), 0) from dataset_version;
+	`
+
+	INSERT_DATASET_VERSION = `
+		insert into dataset_version(id) values(default)
+		returning id;
+	`
+
+	INSERT_TIMETABLE_CHANGE = `
+		insert into timetable_change(version, vehicle, number, direction, kind, details)
+		values($1, $2, $3, $4, $5, $6);
+	`
+
+	GET_CHANGES_FOR_LINE = `
+		select timetable_change.version, dataset_version.created_at as createdAt,
+			timetable_change.direction, timetable_change.kind, timetable_change.details
+		from timetable_change
+		left outer join dataset_version on dataset_version.id = timetable_change.version
+		where timetable_change.number = $1 and timetable_change.vehicle = $2
+			and dataset_version.created_at >= $3
+		order by timetable_change.version, timetable_change.id;
+	`
+
+	GET_API_KEYS_BY_PREFIX = `
+		select id, prefix, salt, hash, label, created_at as createdAt,
+			expires_at as expiresAt, scopes
+		from api_key
+		where prefix = $1;
+	`
+
+	GET_API_KEYS = `
+		select id, prefix, salt, hash, label, created_at as createdAt,
+			expires_at as expiresAt, scopes
+		from api_key
+		order by created_at, label;
+	`
+
+	INSERT_API_KEY = `
+		insert into api_key(prefix, salt, hash, label, expires_at, scopes)
+		values($1, $2, $3, $4, $5, $6);
+	`
+
+	DELETE_API_KEY = `
+		delete from api_key where id = $1;
+	`
+
+	GET_PLAINTEXT_API_KEYS = `
+		select value from api_key;
+	`
+
+	HASH_PLAINTEXT_API_KEY = `
+		update api_key set prefix = $2, salt = $3, hash = $4
+		where value = $1;
+	`
+
+	DROP_PLAINTEXT_API_KEYS = `
+		alter table api_key drop column value;
+		alter table api_key alter column prefix set not null;
+		alter table api_key alter column salt set not null;
+		alter table api_key alter column hash set not null;
+	`
+
+	RECORD_API_USAGE = `
+		insert into api_usage(api_key, day, route, requests, upstream_cost)
+		select $1::bigint, $2::date, $3, $4::bigint, $5::bigint
+		where exists(select 1 from api_key where id = $1)
+		on conflict (api_key, day, route) do update
+		set requests = api_usage.requests + excluded.requests,
+			upstream_cost = api_usage.upstream_cost + excluded.upstream_cost;
+	`
+
+	GET_DAILY_API_REQUESTS = `
+		select coalesce(sum(requests), 0) from api_usage
+		where api_key = $1 and day = $2;
+	`
+
+	GET_API_USAGE = `
+		select api_key.prefix as apiKey, api_key.label, api_usage.day, api_usage.route,
+			api_usage.requests, api_usage.upstream_cost as upstreamCost
+		from api_usage
+		left outer join api_key on api_key.id = api_usage.api_key
+		where api_usage.day >= $1 and ($2::bigint = 0 or api_usage.api_key = $2)
+		order by api_usage.day, api_key.prefix, api_usage.route;
+	`
+
+	INSERT_ARRIVAL_HISTORY = `
+		insert into arrival_history(
+			stop, vehicle, number, time, calculated,
+			scheduled_time, delay_minutes, air_conditioning, accessibility
+		)
+		values($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		on conflict do nothing;
+	`
+
+	// only the last prediction for each scheduled arrival is considered,
+	// since it's the closest to the actual arrival
+	GET_PUNCTUALITY = `
+		select stop,
+			extract(hour from scheduled_time at time zone 'Europe/Sofia')::int as hour,
+			count(*) as arrivals,
+			avg(delay_minutes)::float as averageDelay,
+			count(*) filter (where delay_minutes between $6 and $7) as onTime
+		from (
+			select distinct on (stop, scheduled_time) stop, scheduled_time, delay_minutes
+			from arrival_history
+			where number = $1 and vehicle = $2
+				and scheduled_time >= $3 and scheduled_time < $4
+				and ($5::int is null or stop = $5)
+			order by stop, scheduled_time, calculated desc
+		) last_predictions
+		group by stop, hour
+		order by stop, hour;
+	`
 )
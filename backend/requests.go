@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/schedules"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -41,6 +42,10 @@ func (b *Backend) Routes(
 			)
 		}
 
+		if len(directionRouteConnection) == 0 {
+			return nil, ErrNoSuchLine
+		}
+
 		for i := range directionRouteConnection {
 			stops = nil
 
@@ -60,6 +65,94 @@ func (b *Backend) Routes(
 
 		return routes, nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data.([]*common.Route), nil
+}
+
+// ScheduledArrivals returns the scheduled arrivals at the given stop, grouped
+// by line and direction. Only arrivals valid for dayType (schedules.None
+// meaning any day) and falling between from and to (nil meaning unbounded)
+// are returned. ErrNoSuchStop is returned if the stop doesn't exist.
+func (b *Backend) ScheduledArrivals(
+	stopID int, dayType schedules.ScheduleType, from *schedules.Time, to *schedules.Time,
+) ([]*schedules.LineArrivals, error) {
+	if dayType == schedules.None {
+		dayType = schedules.All
+	}
+	if from == nil {
+		from = schedules.NewTime(0, 0)
+	}
+	if to == nil {
+		to = schedules.NewTime(24, 0)
+	}
+
+	err := b.CheckStop(stopID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Vehicle   common.VehicleType
+		Number    string
+		Direction string
+		Course    int
+		Time      *schedules.Time
+		DayType   schedules.ScheduleType
+	}
 
-	return data.([]*common.Route), err
+	err = b.db.Select(
+		&rows,
+		GET_SCHEDULED_ARRIVALS_FOR_STOP,
+		stopID, dayType, from, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"unable to select scheduled arrivals for stop %d from db: %s",
+			stopID, err,
+		)
+	}
+
+	var lineArrivals []*schedules.LineArrivals
+	var current *schedules.LineArrivals
+	for _, row := range rows {
+		if current == nil ||
+			current.Line.Vehicle != row.Vehicle ||
+			current.Line.Number != row.Number ||
+			current.Direction != row.Direction {
+
+			current = &schedules.LineArrivals{
+				Line: &common.Line{
+					Vehicle: row.Vehicle,
+					Number:  row.Number,
+				},
+				Direction: row.Direction,
+			}
+			lineArrivals = append(lineArrivals, current)
+		}
+
+		current.Arrivals = append(current.Arrivals, &schedules.Arrival{
+			Time:    row.Time,
+			DayType: row.DayType,
+			Course:  row.Course,
+		})
+	}
+
+	return lineArrivals, nil
+}
+
+// CheckStop returns ErrNoSuchStop if there is no stop with the given ID
+func (b *Backend) CheckStop(stopID int) error {
+	var exists bool
+	err := b.db.Get(&exists, STOP_EXISTS, stopID)
+	if err != nil {
+		return fmt.Errorf("unable to check if stop %d exists: %s", stopID, err)
+	}
+
+	if !exists {
+		return ErrNoSuchStop
+	}
+	return nil
 }
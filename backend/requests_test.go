@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/schedules"
 )
 
 func TestBackend_Transports(t *testing.T) {
@@ -43,11 +44,13 @@ func TestBackend_Routes(t *testing.T) {
 			Direction: "A - B",
 			Stops: []*common.Stop{
 				&common.Stop{
-					ID:          4,
-					Name:        "qux",
-					Description: "Qux",
-					Latitude:    42,
-					Longitude:  26,
+					ID:                4,
+					Name:              "qux",
+					InternationalName: "Qux International",
+					CommunityName:     "Qux Community",
+					Description:       "Qux",
+					Latitude:          42,
+					Longitude:         26,
 				},
 				&common.Stop{
 					ID:          5,
@@ -95,3 +98,68 @@ func TestBackend_Routes(t *testing.T) {
 
 	assertEqualJSON(expected, routes, t)
 }
+
+func TestBackend_ScheduledArrivals(t *testing.T) {
+	backend := fillDatabase(t)
+	defer closeBackend(t, backend)
+
+	arrivals, err := backend.ScheduledArrivals(2, schedules.None, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*schedules.LineArrivals{
+		&schedules.LineArrivals{
+			Line: &common.Line{
+				Vehicle: common.Tram,
+				Number:  "10",
+			},
+			Direction: "A - B",
+			Arrivals: []*schedules.Arrival{
+				&schedules.Arrival{
+					Time:    schedules.NewTime(12, 30),
+					DayType: schedules.Workday,
+					Course:  1,
+				},
+				&schedules.Arrival{
+					Time:    schedules.NewTime(13, 30),
+					DayType: schedules.Workday,
+					Course:  2,
+				},
+				&schedules.Arrival{
+					Time:    schedules.NewTime(14, 30),
+					DayType: schedules.HolidayAndPreHoliday,
+					Course:  1,
+				},
+			},
+		},
+	}
+
+	assertEqualJSON(expected, arrivals, t)
+
+	arrivals, err = backend.ScheduledArrivals(
+		2, schedules.Workday, schedules.NewTime(13, 0), nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected[0].Arrivals = expected[0].Arrivals[1:2]
+
+	assertEqualJSON(expected, arrivals, t)
+
+	_, err = backend.ScheduledArrivals(42, schedules.None, nil, nil)
+	if err != ErrNoSuchStop {
+		t.Errorf("expected ErrNoSuchStop for nonexistent stop, got %v", err)
+	}
+}
+
+func TestBackend_Routes_NoSuchLine(t *testing.T) {
+	backend := fillDatabase(t)
+	defer closeBackend(t, backend)
+
+	_, err := backend.Routes("42", common.Bus)
+	if err != ErrNoSuchLine {
+		t.Errorf("expected ErrNoSuchLine, got %v", err)
+	}
+}
@@ -1,7 +1,7 @@
 package backend
 
 /*
-Stop(_id, name<string>, description<string>, location<gps>)
+Stop(_id, name<string>, international_name<string>, community_name<string>, description<string>, location<gps>)
 
 Transport(_id, type<bus, tram, trolley>, number<string>)
 
@@ -12,66 +12,216 @@ RouteStop(route_id, number<int>, stop_id)
 Arrival(route_id, stop_id, course<int>, time<int, hour * 60 + minute>, type<workday, holiday etc>)
 */
 
-const schema = `
-	create table stop(
-		id int primary key,
-		name varchar(1024),
-		description varchar(2048),
-		latitude real,
-		longitude real
-	);
-
-	create table line(
-		id bigserial primary key,
-		vehicle int,
-		number varchar(10)
-	);
-
-	create table route(
-		id bigserial primary key,
-		line bigint references line(id),
-		direction varchar(1024)
-	);
-
-	create table route_stop(
-		route bigint references route(id),
-		index int,
-		stop bigint references stop(id),
-
-		primary key(route, stop)
-	);
-
-	create table arrival(
-		route bigint not null,
-		stop bigint not null,
-		course int,
-		time int,
-		day_type int,
-
-		foreign key(route, stop) references route_stop(route, stop)
-	);
-
-	create index arrival_route_stop on arrival(route, stop);
-
-	create table api_key(
-		value char(64) primary key
-	);
-`
-
-const dropSchema = `
-	drop table api_key;
-	drop index arrival_route_stop;
-	drop table arrival;
-	drop table route_stop;
-	drop table route;
-	drop table stop;
-	drop table line;
-`
-
-const clearTransportSchema = `
-	truncate arrival cascade;
-	truncate route_stop cascade;
-	truncate route cascade;
-	truncate stop cascade;
-	truncate line cascade;
-`
+// migrations contains all changes to the schema, in the order they must be
+// applied. Migrations must never be changed once released - add a new one
+// instead.
+var migrations = []migration{
+	{
+		description: "initial schema",
+		up: `
+			create table stop(
+				id int primary key,
+				name varchar(1024),
+				description varchar(2048),
+				latitude real,
+				longitude real
+			);
+
+			create table line(
+				id bigserial primary key,
+				vehicle int,
+				number varchar(10)
+			);
+
+			create table route(
+				id bigserial primary key,
+				line bigint references line(id),
+				direction varchar(1024)
+			);
+
+			create table route_stop(
+				route bigint references route(id),
+				index int,
+				stop bigint references stop(id),
+
+				primary key(route, stop)
+			);
+
+			create table arrival(
+				route bigint not null,
+				stop bigint not null,
+				course int,
+				time int,
+				day_type int,
+
+				foreign key(route, stop) references route_stop(route, stop)
+			);
+
+			create index arrival_route_stop on arrival(route, stop);
+
+			create table api_key(
+				value char(64) primary key
+			);
+		`,
+		down: `
+			drop table api_key;
+			drop index arrival_route_stop;
+			drop table arrival;
+			drop table route_stop;
+			drop table route;
+			drop table stop;
+			drop table line;
+		`,
+	},
+	{
+		description: "international and community names of stops",
+		// existing stops get empty names, since NULLs can't be scanned
+		// into common.Stop
+		up: `
+			alter table stop add column if not exists international_name varchar(1024) not null default '';
+			alter table stop add column if not exists community_name varchar(1024) not null default '';
+		`,
+		down: `
+			alter table stop drop column international_name;
+			alter table stop drop column community_name;
+		`,
+	},
+	{
+		description: "natural keys for lines and routes",
+		// a line can have several routes in the same direction, which are
+		// told apart by their variant. Older versions could also insert the
+		// same line twice; such databases can't be migrated in place.
+		up: `
+			do $$
+			begin
+				if exists(select 1 from line group by vehicle, number having count(*) > 1) then
+					raise exception 'the database contains duplicate lines: drop it, migrate and fill it again';
+				end if;
+			end
+			$$;
+
+			alter table line add constraint line_vehicle_number unique(vehicle, number);
+
+			alter table route add column variant int not null default 0;
+			update route set variant = numbered.variant
+			from (
+				select id, row_number() over (partition by line, direction order by id) - 1 as variant
+				from route
+			) as numbered
+			where route.id = numbered.id;
+			alter table route add constraint route_line_direction_variant unique(line, direction, variant);
+		`,
+		down: `
+			alter table route drop constraint route_line_direction_variant;
+			alter table route drop column variant;
+			alter table line drop constraint line_vehicle_number;
+		`,
+	},
+	{
+		description: "timetable change history",
+		up: `
+			create table dataset_version(
+				id bigserial primary key,
+				created_at timestamp with time zone not null default now()
+			);
+
+			create table timetable_change(
+				id bigserial primary key,
+				version bigint not null references dataset_version(id),
+				vehicle int not null,
+				number varchar(10) not null,
+				direction varchar(1024) not null,
+				kind varchar(32) not null,
+				details text not null
+			);
+
+			create index timetable_change_line on timetable_change(vehicle, number);
+		`,
+		down: `
+			drop index timetable_change_line;
+			drop table timetable_change;
+			drop table dataset_version;
+		`,
+	},
+	{
+		description: "API key metadata",
+		// existing keys keep access to everything they could use before
+		up: `
+			alter table api_key add column label varchar(256) not null default '';
+			alter table api_key add column created_at timestamp with time zone not null default now();
+			alter table api_key add column expires_at timestamp with time zone;
+			alter table api_key add column scopes varchar(256) not null default 'static,realtime';
+		`,
+		down: `
+			alter table api_key drop column scopes;
+			alter table api_key drop column expires_at;
+			alter table api_key drop column created_at;
+			alter table api_key drop column label;
+		`,
+	},
+	{
+		description: "hashed API keys",
+		up: `
+			alter table api_key drop constraint api_key_pkey;
+			alter table api_key add column id bigserial primary key;
+			alter table api_key add column prefix char(8);
+			alter table api_key add column salt char(32);
+			alter table api_key add column hash char(64);
+			create index api_key_prefix on api_key(prefix);
+		`,
+		upFunc: hashPlaintextAPIKeys,
+		// the keys can't be recovered from their hashes, so reverting
+		// this migration deletes all of them
+		down: `
+			delete from api_key;
+			drop index api_key_prefix;
+			alter table api_key drop column hash;
+			alter table api_key drop column salt;
+			alter table api_key drop column prefix;
+			alter table api_key drop column id;
+			alter table api_key add column value char(64) primary key;
+		`,
+	},
+	{
+		description: "API usage accounting",
+		up: `
+			create table api_usage(
+				api_key bigint not null references api_key(id) on delete cascade,
+				day date not null,
+				route varchar(256) not null,
+				requests bigint not null,
+				upstream_cost bigint not null,
+
+				primary key(api_key, day, route)
+			);
+		`,
+		down: `
+			drop table api_usage;
+		`,
+	},
+	{
+		description: "realtime arrival history",
+		up: `
+			create table arrival_history(
+				id bigserial primary key,
+				stop int not null,
+				vehicle int not null,
+				number varchar(10) not null,
+				time timestamp with time zone not null,
+				calculated timestamp with time zone not null,
+				scheduled_time timestamp with time zone,
+				delay_minutes int,
+				air_conditioning boolean not null,
+				accessibility boolean not null,
+
+				unique(stop, vehicle, number, time, calculated)
+			);
+
+			create index arrival_history_line on arrival_history(vehicle, number, scheduled_time);
+		`,
+		down: `
+			drop index arrival_history_line;
+			drop table arrival_history;
+		`,
+	},
+}
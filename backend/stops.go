@@ -0,0 +1,133 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/fuzzy"
+	"github.com/lib/pq"
+)
+
+// NearbyStops returns at most limit stops which are at most radius metres
+// away from the given point, ordered by distance
+func (b *Backend) NearbyStops(
+	latitude float64, longitude float64, radius float64, limit int,
+) ([]*common.NearbyStop, error) {
+	var rows []struct {
+		common.Stop
+		Distance float64
+	}
+
+	err := b.db.Select(&rows, GET_NEARBY_STOPS, latitude, longitude, radius, limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to select nearby stops from db: %s", err)
+	}
+
+	stops := make([]*common.Stop, len(rows))
+	nearbyStops := make([]*common.NearbyStop, len(rows))
+	for i := range rows {
+		stops[i] = &common.Stop{}
+		*stops[i] = rows[i].Stop
+
+		nearbyStops[i] = &common.NearbyStop{
+			Stop:     stops[i],
+			Distance: rows[i].Distance,
+		}
+	}
+
+	lines, err := b.stopLines(stops)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range nearbyStops {
+		nearbyStops[i].Lines = lines[nearbyStops[i].Stop.ID]
+	}
+
+	return nearbyStops, nil
+}
+
+// stopLines returns the lines which serve each of the given stops
+func (b *Backend) stopLines(stops []*common.Stop) (map[int][]*common.Line, error) {
+	ids := make([]int64, len(stops))
+	for i := range stops {
+		ids[i] = int64(stops[i].ID)
+	}
+
+	var rows []struct {
+		Stop    int
+		Vehicle common.VehicleType
+		Number  string
+	}
+
+	err := b.db.Select(&rows, GET_LINES_FOR_STOPS, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("unable to select lines for stops from db: %s", err)
+	}
+
+	lines := make(map[int][]*common.Line)
+	for _, row := range rows {
+		lines[row.Stop] = append(lines[row.Stop], &common.Line{
+			Vehicle: row.Vehicle,
+			Number:  row.Number,
+		})
+	}
+
+	return lines, nil
+}
+
+// SearchStops returns at most limit stops whose names match the query,
+// ordered from the best match to the worst one. The query may contain typos
+// and may be written in Latin instead of Cyrillic. A query which is a stop
+// code matches that stop exactly.
+func (b *Backend) SearchStops(query string, limit int) ([]*common.Stop, error) {
+	var stops []*common.Stop
+	err := b.db.Select(&stops, GET_ALL_STOPS)
+	if err != nil {
+		return nil, fmt.Errorf("unable to select stops from db: %s", err)
+	}
+
+	code, err := strconv.Atoi(strings.TrimSpace(query))
+	isCode := err == nil
+
+	type match struct {
+		stop  *common.Stop
+		score float64
+	}
+
+	var matches []match
+	for _, stop := range stops {
+		score := 0.0
+		if isCode && stop.ID == code {
+			score = 2
+		}
+
+		for _, name := range []string{stop.Name, stop.InternationalName, stop.CommunityName} {
+			if nameScore := fuzzy.Score(query, name); nameScore > score {
+				score = nameScore
+			}
+		}
+
+		if score > 0 {
+			matches = append(matches, match{stop: stop, score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	result := make([]*common.Stop, len(matches))
+	for i := range matches {
+		result[i] = matches[i].stop
+	}
+
+	return result, nil
+}
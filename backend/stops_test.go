@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/DexterLB/skgt_api/common"
+)
+
+func TestBackend_NearbyStops(t *testing.T) {
+	backend := fillDatabase(t)
+	defer closeBackend(t, backend)
+
+	stops, err := backend.NearbyStops(42, 26, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tram10 := []*common.Line{
+		&common.Line{
+			Vehicle: common.Tram,
+			Number:  "10",
+		},
+	}
+
+	expected := []*common.NearbyStop{
+		&common.NearbyStop{
+			Stop: &common.Stop{
+				ID:          1,
+				Name:        "foo",
+				Description: "FOO",
+				Latitude:    42,
+				Longitude:   26,
+			},
+			Distance: 0,
+			Lines:    tram10,
+		},
+		&common.NearbyStop{
+			Stop: &common.Stop{
+				ID:          2,
+				Name:        "bar",
+				Description: "BAR",
+				Latitude:    42,
+				Longitude:   26,
+			},
+			Distance: 0,
+			Lines:    tram10,
+		},
+	}
+
+	assertEqualJSON(expected, stops, t)
+
+	stops, err = backend.NearbyStops(43, 26, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stops) != 0 {
+		t.Errorf("found %d stops 100km away with a radius of 100m", len(stops))
+	}
+}
+
+func TestBackend_SearchStops(t *testing.T) {
+	backend := fillDatabase(t)
+	defer closeBackend(t, backend)
+
+	for query, expected := range map[string][]int{
+		"qux":  []int{4},
+		"quxx": []int{4, 5},
+		"7":    []int{7},
+		"bar":  []int{2},
+		"zzz":  []int{},
+	} {
+		stops, err := backend.SearchStops(query, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []int{}
+		for _, stop := range stops {
+			ids = append(ids, stop.ID)
+		}
+
+		assertEqualJSON(expected, ids, t)
+	}
+}
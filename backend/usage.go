@@ -0,0 +1,83 @@
+package backend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// UsageRecord is a number of requests made with an API key to a route on
+// a day, to be added to the usage stored in the database
+type UsageRecord struct {
+	APIKeyID     int64
+	Day          time.Time
+	Route        string
+	Requests     int64
+	UpstreamCost int64
+}
+
+// Usage is the total number of requests made with an API key to a route
+// on a day. UpstreamCost is the number of lookups on SKGT's virtual board
+// made for these requests (cached arrivals cost nothing).
+type Usage struct {
+	APIKey       string // prefix of the key
+	Label        string
+	Day          time.Time
+	Route        string
+	Requests     int64
+	UpstreamCost int64
+}
+
+// RecordUsage adds the given records to the stored usage. Records for API
+// keys which have been deleted in the meantime are dropped.
+func (b *Backend) RecordUsage(records []*UsageRecord) error {
+	_, err := b.Wrap(func(tx *sqlx.Tx) (interface{}, error) {
+		for _, record := range records {
+			_, err := tx.Exec(
+				RECORD_API_USAGE,
+				record.APIKeyID, record.Day.Format("2006-01-02"), record.Route,
+				record.Requests, record.UpstreamCost,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("unable to record usage: %s", err)
+			}
+		}
+		return nil, nil
+	})
+
+	return err
+}
+
+// DailyRequests returns the number of stored requests made with an API key
+// on the given day
+func (b *Backend) DailyRequests(apiKeyID int64, day time.Time) (int64, error) {
+	var requests int64
+	err := b.db.Get(&requests, GET_DAILY_API_REQUESTS, apiKeyID, day.Format("2006-01-02"))
+	if err != nil {
+		return 0, fmt.Errorf("unable to select daily requests: %s", err)
+	}
+
+	return requests, nil
+}
+
+// APIUsage returns the usage of an API key (given in full or by its prefix,
+// or empty for all keys) since the given day
+func (b *Backend) APIUsage(apiKey string, since time.Time) ([]*Usage, error) {
+	var id int64
+	if apiKey != "" {
+		var err error
+		id, err = b.resolveAPIKey(apiKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var usage []*Usage
+	err := b.db.Select(&usage, GET_API_USAGE, since.Format("2006-01-02"), id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to select usage: %s", err)
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,96 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackend_APIUsage(t *testing.T) {
+	backend := openBackend(t)
+	defer closeBackend(t, backend)
+
+	apiKey, err := backend.NewAPIKey("test", nil)
+	if err != nil {
+		t.Fatalf("cannot create api key: %s", err)
+	}
+
+	key, err := backend.CheckAPIKey(apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		err = backend.RecordUsage([]*UsageRecord{
+			{APIKeyID: key.ID, Day: day, Route: "/stops/search", Requests: 3},
+			{APIKeyID: key.ID, Day: day.AddDate(0, 0, 1), Route: "/stops/search", Requests: 1, UpstreamCost: 2},
+		})
+		if err != nil {
+			t.Fatalf("cannot record usage: %s", err)
+		}
+	}
+
+	usage, err := backend.APIUsage(key.Prefix, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("cannot get usage: %s", err)
+	}
+
+	if len(usage) != 1 {
+		t.Fatalf("got %d usage rows instead of 1", len(usage))
+	}
+	if usage[0].Requests != 2 || usage[0].UpstreamCost != 4 || usage[0].Label != "test" {
+		t.Errorf("wrong usage: %+v", usage[0])
+	}
+
+	all, err := backend.APIUsage("", day)
+	if err != nil {
+		t.Fatalf("cannot get usage: %s", err)
+	}
+	if len(all) != 2 || all[0].Requests != 6 {
+		t.Errorf("wrong usage for all keys: %+v", all)
+	}
+
+	requests, err := backend.DailyRequests(key.ID, day)
+	if err != nil {
+		t.Fatalf("cannot get daily requests: %s", err)
+	}
+	if requests != 6 {
+		t.Errorf("got %d daily requests instead of 6", requests)
+	}
+
+	requests, err = backend.DailyRequests(key.ID, day.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatalf("cannot get daily requests: %s", err)
+	}
+	if requests != 0 {
+		t.Errorf("got %d daily requests on a day without usage", requests)
+	}
+}
+
+func TestBackend_RecordUsage_DeletedKey(t *testing.T) {
+	backend := openBackend(t)
+	defer closeBackend(t, backend)
+
+	apiKey, err := backend.NewAPIKey("test", nil)
+	if err != nil {
+		t.Fatalf("cannot create api key: %s", err)
+	}
+
+	key, err := backend.CheckAPIKey(apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = backend.DeleteAPIKey(apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	err = backend.RecordUsage([]*UsageRecord{
+		{APIKeyID: key.ID, Day: day, Route: "/stops/search", Requests: 1},
+	})
+	if err != nil {
+		t.Errorf("usage of a deleted key was not dropped: %s", err)
+	}
+}
@@ -0,0 +1,126 @@
+// Package calendar resolves dates to the day types of the schedules,
+// taking weekends, Bulgarian public holidays and exceptions declared by
+// the operator into account.
+package calendar
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DexterLB/skgt_api/schedules"
+)
+
+// DateFormat is the format of dates in overrides and in the API
+const DateFormat = "2006-01-02"
+
+// Override is an exception declared by the operator, which runs the given
+// day type's schedule on some date
+type Override struct {
+	Date        time.Time
+	DayType     schedules.ScheduleType
+	Description string
+}
+
+// ParseOverride parses an override from a date (YYYY-MM-DD) and a day type
+// name (as accepted by schedules.ParseScheduleType)
+func ParseOverride(date string, dayType string, description string) (*Override, error) {
+	parsedDate, err := time.Parse(DateFormat, date)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse date: %s", err)
+	}
+
+	parsedDayType, err := schedules.ParseScheduleType(dayType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Override{
+		Date:        parsedDate,
+		DayType:     parsedDayType,
+		Description: description,
+	}, nil
+}
+
+// Day describes which schedule runs on a date and why
+type Day struct {
+	Date    string
+	DayType schedules.ScheduleType
+	// Holiday contains the names of the public holidays on the date
+	Holiday string `json:",omitempty"`
+	// Override is the description of the operator's exception for the
+	// date, if there is one
+	Override string `json:",omitempty"`
+}
+
+// Calendar resolves dates to day types
+type Calendar struct {
+	overrides map[string]*Override
+
+	mutex    sync.Mutex
+	holidays map[int][]*Holiday
+}
+
+// New returns a calendar with the given overrides. Later overrides for
+// the same date replace earlier ones.
+func New(overrides []*Override) *Calendar {
+	c := &Calendar{
+		overrides: make(map[string]*Override),
+		holidays:  make(map[int][]*Holiday),
+	}
+
+	for _, override := range overrides {
+		c.overrides[override.Date.Format(DateFormat)] = override
+	}
+
+	return c
+}
+
+// Day returns the day type of a date (the date of t in its location) and
+// how it was determined: overrides take precedence over public holidays,
+// which take precedence over weekends.
+func (c *Calendar) Day(t time.Time) *Day {
+	date := t.Format(DateFormat)
+	day := &Day{Date: date}
+
+	var names []string
+	for _, holiday := range c.yearHolidays(t.Year()) {
+		if holiday.Date.Format(DateFormat) == date {
+			names = append(names, holiday.Name)
+		}
+	}
+	day.Holiday = strings.Join(names, ", ")
+
+	override, ok := c.overrides[date]
+	switch {
+	case ok:
+		day.DayType = override.DayType
+		day.Override = override.Description
+	case day.Holiday != "":
+		day.DayType = schedules.Holiday
+	default:
+		day.DayType = schedules.DayTypeOf(t)
+	}
+
+	return day
+}
+
+// DayType returns the day type of a date (the date of t in its location)
+func (c *Calendar) DayType(t time.Time) schedules.ScheduleType {
+	return c.Day(t).DayType
+}
+
+// yearHolidays returns the holidays in a year, computing them only once
+func (c *Calendar) yearHolidays(year int) []*Holiday {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	holidays, ok := c.holidays[year]
+	if !ok {
+		holidays = Holidays(year)
+		c.holidays[year] = holidays
+	}
+
+	return holidays
+}
@@ -0,0 +1,103 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/schedules"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestOrthodoxEaster(t *testing.T) {
+	for year, expected := range map[int]time.Time{
+		2017: date(2017, time.April, 16),
+		2021: date(2021, time.May, 2),
+		2023: date(2023, time.April, 16),
+		2024: date(2024, time.May, 5),
+		2025: date(2025, time.April, 20),
+		2026: date(2026, time.April, 12),
+	} {
+		if actual := OrthodoxEaster(year); !actual.Equal(expected) {
+			t.Errorf("Easter in %d computed as %s instead of %s", year, actual, expected)
+		}
+	}
+}
+
+func TestHolidays_Observed(t *testing.T) {
+	holidays := Holidays(2022)
+
+	// Christmas Eve and Christmas Day were on the weekend and Dec 26 was
+	// already a holiday, so they were observed on Dec 27 and 28
+	for _, observed := range []time.Time{
+		date(2022, time.December, 27),
+		date(2022, time.December, 28),
+	} {
+		if findHoliday(holidays, observed) == nil {
+			t.Errorf("%s is not a holiday", observed.Format(DateFormat))
+		}
+	}
+
+	if holiday := findHoliday(holidays, date(2022, time.December, 29)); holiday != nil {
+		t.Errorf("Dec 29 is a holiday: %s", holiday.Name)
+	}
+
+	// Easter holidays are never moved
+	if holiday := findHoliday(holidays, date(2022, time.April, 26)); holiday != nil {
+		t.Errorf("Apr 26 is a holiday: %s", holiday.Name)
+	}
+
+	for i := 1; i < len(holidays); i++ {
+		if holidays[i].Date.Before(holidays[i-1].Date) {
+			t.Errorf("holidays are not ordered by date")
+		}
+	}
+}
+
+func TestCalendar_Day(t *testing.T) {
+	override, err := ParseOverride("2024-05-03", "preholiday", "between Labour Day and Easter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New([]*Override{override})
+
+	location, _ := time.LoadLocation("Europe/Sofia")
+
+	for _, test := range []struct {
+		date     time.Time
+		expected schedules.ScheduleType
+		holiday  string
+	}{
+		{time.Date(2024, time.April, 30, 12, 0, 0, 0, location), schedules.Workday, ""},
+		{time.Date(2024, time.May, 1, 12, 0, 0, 0, location), schedules.Holiday, "Labour Day"},
+		{time.Date(2024, time.May, 3, 12, 0, 0, 0, location), schedules.PreHoliday, "Good Friday"},
+		{time.Date(2024, time.May, 6, 12, 0, 0, 0, location), schedules.Holiday, "Easter Monday, St. George's Day"},
+		{time.Date(2024, time.May, 11, 12, 0, 0, 0, location), schedules.PreHoliday, ""},
+		{time.Date(2024, time.May, 12, 12, 0, 0, 0, location), schedules.Holiday, ""},
+		{time.Date(2024, time.September, 23, 12, 0, 0, 0, location), schedules.Holiday, "Independence Day (observed)"},
+	} {
+		day := c.Day(test.date)
+		if day.DayType != test.expected || day.Holiday != test.holiday {
+			t.Errorf(
+				"%s is %s (%s) instead of %s (%s)",
+				day.Date, day.DayType, day.Holiday, test.expected, test.holiday,
+			)
+		}
+	}
+
+	if day := c.Day(date(2024, time.May, 3)); day.Override != "between Labour Day and Easter" {
+		t.Errorf("override is not described: %+v", day)
+	}
+}
+
+func TestParseOverride(t *testing.T) {
+	if _, err := ParseOverride("2024-13-01", "holiday", ""); err == nil {
+		t.Errorf("invalid date accepted")
+	}
+	if _, err := ParseOverride("2024-05-03", "weekday", ""); err == nil {
+		t.Errorf("invalid day type accepted")
+	}
+}
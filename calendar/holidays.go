@@ -0,0 +1,128 @@
+package calendar
+
+import (
+	"sort"
+	"time"
+)
+
+// Holiday is a Bulgarian public holiday
+type Holiday struct {
+	Date time.Time
+	Name string
+}
+
+// fixedHolidays are the public holidays with the same date every year
+var fixedHolidays = []struct {
+	month time.Month
+	day   int
+	name  string
+}{
+	{time.January, 1, "New Year's Day"},
+	{time.March, 3, "Liberation Day"},
+	{time.May, 1, "Labour Day"},
+	{time.May, 6, "St. George's Day"},
+	{time.May, 24, "Culture and Literacy Day"},
+	{time.September, 6, "Unification Day"},
+	{time.September, 22, "Independence Day"},
+	{time.December, 24, "Christmas Eve"},
+	{time.December, 25, "Christmas Day"},
+	{time.December, 26, "Christmas Day"},
+}
+
+// Holidays returns the public holidays in the given year, ordered by date.
+// Fixed holidays which fall on a weekend are also observed on the first
+// following working day, as required by the Labour Code. The dates are
+// at midnight UTC.
+func Holidays(year int) []*Holiday {
+	var holidays []*Holiday
+
+	easter := OrthodoxEaster(year)
+	for _, easterHoliday := range []struct {
+		offset int
+		name   string
+	}{
+		{-2, "Good Friday"},
+		{-1, "Holy Saturday"},
+		{0, "Easter"},
+		{1, "Easter Monday"},
+	} {
+		holidays = append(holidays, &Holiday{
+			Date: easter.AddDate(0, 0, easterHoliday.offset),
+			Name: easterHoliday.name,
+		})
+	}
+
+	var weekendHolidays []*Holiday
+	for _, fixed := range fixedHolidays {
+		holiday := &Holiday{
+			Date: time.Date(year, fixed.month, fixed.day, 0, 0, 0, 0, time.UTC),
+			Name: fixed.name,
+		}
+		holidays = append(holidays, holiday)
+
+		if isWeekend(holiday.Date) {
+			weekendHolidays = append(weekendHolidays, holiday)
+		}
+	}
+
+	sortHolidays(holidays)
+
+	// each weekend holiday is moved to a separate working day, so those
+	// are found in order
+	for _, holiday := range weekendHolidays {
+		date := holiday.Date.AddDate(0, 0, 1)
+		for isWeekend(date) || findHoliday(holidays, date) != nil {
+			date = date.AddDate(0, 0, 1)
+		}
+
+		holidays = append(holidays, &Holiday{
+			Date: date,
+			Name: holiday.Name + " (observed)",
+		})
+		sortHolidays(holidays)
+	}
+
+	return holidays
+}
+
+// OrthodoxEaster returns the date of the Orthodox Easter in the given year
+// (in the Gregorian calendar, at midnight UTC)
+func OrthodoxEaster(year int) time.Time {
+	// Meeus's algorithm for the Julian calendar
+	a := year % 4
+	b := year % 7
+	c := year % 19
+	d := (19*c + 15) % 30
+	e := (2*a + 4*b - d + 34) % 7
+	month := (d + e + 114) / 31
+	day := (d+e+114)%31 + 1
+
+	// difference between the Julian and the Gregorian calendar
+	julianOffset := year/100 - year/400 - 2
+
+	return time.Date(year, time.Month(month), day+julianOffset, 0, 0, 0, 0, time.UTC)
+}
+
+func isWeekend(date time.Time) bool {
+	return date.Weekday() == time.Saturday || date.Weekday() == time.Sunday
+}
+
+func sortHolidays(holidays []*Holiday) {
+	sort.SliceStable(holidays, func(i, j int) bool {
+		return holidays[i].Date.Before(holidays[j].Date)
+	})
+}
+
+// findHoliday returns the holiday on the given date (nil if there isn't any)
+func findHoliday(holidays []*Holiday, date time.Time) *Holiday {
+	for _, holiday := range holidays {
+		if sameDay(holiday.Date, date) {
+			return holiday
+		}
+	}
+	return nil
+}
+
+func sameDay(a time.Time, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month() && a.Day() == b.Day()
+}
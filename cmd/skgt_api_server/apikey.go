@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/DexterLB/skgt_api/backend"
 	"github.com/urfave/cli"
 )
 
@@ -11,27 +14,24 @@ func runAPIKey(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	backend, err := initBackend(config)
+	b, err := initBackend(config)
 	if err != nil {
 		return err
 	}
 
 	apiKey := c.String("check")
 	if apiKey != "" {
-		err := backend.CheckAPIKey(apiKey)
+		key, err := b.CheckAPIKey(apiKey)
 		if err != nil {
 			return err
 		}
 		fmt.Printf("API key is valid.\n")
+		printAPIKey(key)
 	}
 
 	apiKey = c.String("delete")
 	if apiKey != "" {
-		err := backend.CheckAPIKey(apiKey)
-		if err != nil {
-			return err
-		}
-		err = backend.DeleteAPIKey(apiKey)
+		err := b.DeleteAPIKey(apiKey)
 		if err != nil {
 			return err
 		}
@@ -39,12 +39,73 @@ func runAPIKey(c *cli.Context) error {
 	}
 
 	if c.Bool("new") {
-		apiKey, err := backend.NewAPIKey()
+		var expiresAt *time.Time
+		if c.String("expires") != "" {
+			expiry, err := time.ParseInLocation("2006-01-02", c.String("expires"), time.Local)
+			if err != nil {
+				return fmt.Errorf("unable to parse expiry date: %s", err)
+			}
+			expiresAt = &expiry
+		}
+
+		scopes, err := backend.ParseScopes(c.String("scope"))
+		if err != nil {
+			return err
+		}
+
+		apiKey, err := b.NewAPIKey(c.String("label"), expiresAt, scopes...)
 		if err != nil {
 			return err
 		}
 		fmt.Printf("%s\n", apiKey)
 	}
 
+	apiKey = c.String("usage")
+	if apiKey != "" {
+		usage, err := b.APIUsage(apiKey, time.Time{})
+		if err != nil {
+			return err
+		}
+
+		for _, u := range usage {
+			fmt.Printf(
+				"%s  %-50s  %8d requests  %6d upstream lookups\n",
+				u.Day.Format("2006-01-02"), u.Route, u.Requests, u.UpstreamCost,
+			)
+		}
+	}
+
+	if c.Bool("list") {
+		keys, err := b.APIKeys()
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			printAPIKey(key)
+		}
+	}
+
 	return nil
 }
+
+func printAPIKey(key *backend.APIKey) {
+	expires := "never"
+	if key.ExpiresAt != nil {
+		expires = key.ExpiresAt.Format("2006-01-02")
+		if key.Expired(time.Now()) {
+			expires += " (expired)"
+		}
+	}
+
+	scopes := make([]string, len(key.Scopes))
+	for i := range key.Scopes {
+		scopes[i] = string(key.Scopes[i])
+	}
+
+	fmt.Printf(
+		"%s  %-20s  created %s  expires %-20s  %s\n",
+		key.Prefix, key.Label, key.CreatedAt.Format("2006-01-02"),
+		expires, strings.Join(scopes, ","),
+	)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/DexterLB/htmlparsing"
+	"github.com/DexterLB/skgt_api/backend"
+	"github.com/DexterLB/skgt_api/calendar"
+	"github.com/DexterLB/skgt_api/config"
+	"github.com/DexterLB/skgt_api/delays"
+	"github.com/DexterLB/skgt_api/gtfs"
+	"github.com/DexterLB/skgt_api/realtime"
+	"github.com/urfave/cli"
+)
+
+const defaultCollectInterval = time.Minute
+
+func runCollect(c *cli.Context) error {
+	config, err := parseConfig(c)
+	if err != nil {
+		return err
+	}
+	backend, err := initBackend(config)
+	if err != nil {
+		return err
+	}
+
+	err = backend.CheckSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	solver, err := initCaptchaSolver(config)
+	if err != nil {
+		return err
+	}
+
+	calendar, err := initCalendar(config)
+	if err != nil {
+		return err
+	}
+
+	if len(config.Collector.Stops) == 0 {
+		return fmt.Errorf("no stops to collect arrivals for")
+	}
+
+	interval := time.Duration(config.Collector.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultCollectInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		log.Printf("collecting arrivals for %d stops", len(config.Collector.Stops))
+		collected := collectArrivals(backend, solver, calendar, config)
+		log.Printf("finished collecting arrivals for %d stops", collected)
+
+		if c.Bool("once") {
+			return nil
+		}
+		<-ticker.C
+	}
+}
+
+// collectArrivals stores the current arrivals at all configured stops and
+// returns the number of stops for which this succeeded
+func collectArrivals(
+	b *backend.Backend,
+	solver realtime.CaptchaSolver,
+	calendar *calendar.Calendar,
+	config *config.Config,
+) int {
+	parallelRequests := config.Parser.ParallelRequests
+	if parallelRequests < 1 {
+		parallelRequests = 1
+	}
+
+	in := make(chan int, len(config.Collector.Stops))
+	for _, stopID := range config.Collector.Stops {
+		in <- stopID
+	}
+	close(in)
+
+	var (
+		collected int
+		mutex     sync.Mutex
+	)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(parallelRequests)
+	for i := 0; i < parallelRequests; i++ {
+		go func() {
+			defer wg.Done()
+
+			for stopID := range in {
+				err := collectStop(b, solver, calendar, stopID)
+				if err != nil {
+					log.Printf("warning: unable to collect arrivals for stop %04d: %s", stopID, err)
+					continue
+				}
+
+				mutex.Lock()
+				collected++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return collected
+}
+
+func collectStop(
+	b *backend.Backend, solver realtime.CaptchaSolver, calendar *calendar.Calendar, stopID int,
+) error {
+	arrivals, err := realtime.AllArrivals(htmlparsing.SensibleSettings(), solver, stopID)
+	if err != nil {
+		return fmt.Errorf("unable to get arrivals: %s", err)
+	}
+
+	stopTimes, err := b.StopTimes(stopID, time.Now().In(gtfs.Location), calendar)
+	if err != nil {
+		return fmt.Errorf("unable to get stop times: %s", err)
+	}
+
+	arrivals = delays.Estimate(&delays.StopPredictions{
+		StopID:    stopID,
+		Arrivals:  arrivals,
+		StopTimes: stopTimes,
+	})
+
+	return b.StoreArrivals(stopID, arrivals)
+}
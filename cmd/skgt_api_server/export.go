@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+func runExportGTFS(c *cli.Context) error {
+	config, err := parseConfig(c)
+	if err != nil {
+		return err
+	}
+	backend, err := initBackend(config)
+	if err != nil {
+		return err
+	}
+	calendar, err := initCalendar(config)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(c.String("output"))
+	if err != nil {
+		return fmt.Errorf("unable to create output file: %s", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	start := time.Now()
+	end := start.AddDate(0, 0, c.Int("days"))
+
+	log.Printf("exporting GTFS feed to %s", c.String("output"))
+	err = backend.ExportGTFS(f, start, end, calendar)
+	log.Printf("finished exporting GTFS feed")
+
+	if err != nil {
+		return fmt.Errorf("unable to export GTFS feed: %s", err)
+	}
+
+	return f.Close()
+}
@@ -17,12 +17,14 @@ func runInit(c *cli.Context) error {
 		return err
 	}
 
-	log.Printf("dropping old database")
-	err = backend.DropDB()
-	if err != nil {
-		log.Printf("can't drop database: %s (running for the first time?)", err)
-	} else {
-		log.Printf("dropped old database")
+	if c.Bool("drop") {
+		log.Printf("dropping old database")
+		err = backend.DropDB()
+		if err != nil {
+			log.Printf("can't drop database: %s (running for the first time?)", err)
+		} else {
+			log.Printf("dropped old database")
+		}
 	}
 
 	log.Printf("creating tables")
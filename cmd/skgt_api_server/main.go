@@ -8,13 +8,15 @@ import (
 	"time"
 
 	"github.com/DexterLB/skgt_api/backend"
+	"github.com/DexterLB/skgt_api/calendar"
 	"github.com/DexterLB/skgt_api/config"
+	"github.com/DexterLB/skgt_api/realtime"
 	"github.com/cep21/xdgbasedir"
 	"github.com/urfave/cli"
 )
 
 func main() {
-	// initialise random generator to be able to correctly handle API keys
+	// initialise random generator for the fake mouse coordinates sent to SKGT
 	rand.Seed(time.Now().UTC().UnixNano())
 
 	app := cli.NewApp()
@@ -24,9 +26,47 @@ func main() {
 	app.Commands = []cli.Command{
 		{
 			Name:   "init",
-			Usage:  "initialise an empty database (deletes any old data)",
+			Usage:  "initialise the database, applying all schema migrations",
 			Action: runInit,
-			Flags:  []cli.Flag{},
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "drop",
+					Usage: "drop the old database first (deletes any old data)",
+				},
+			},
+		},
+		{
+			Name:  "migrate",
+			Usage: "manage the version of the database schema",
+			Subcommands: []cli.Command{
+				{
+					Name:   "up",
+					Usage:  "apply migrations (all of them by default)",
+					Action: runMigrateUp,
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "to",
+							Usage: "schema version to migrate to",
+						},
+					},
+				},
+				{
+					Name:   "down",
+					Usage:  "revert migrations (the last one by default)",
+					Action: runMigrateDown,
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "to",
+							Usage: "schema version to migrate to",
+						},
+					},
+				},
+				{
+					Name:   "status",
+					Usage:  "list all migrations and whether they have been applied",
+					Action: runMigrateStatus,
+				},
+			},
 		},
 		{
 			Name:   "update",
@@ -34,12 +74,46 @@ func main() {
 			Action: runUpdate,
 			Flags:  []cli.Flag{},
 		},
+		{
+			Name:   "collect",
+			Usage:  "periodically store the realtime arrivals at the configured stops",
+			Action: runCollect,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "once",
+					Usage: "collect the arrivals once and exit",
+				},
+			},
+		},
 		{
 			Name:   "serve",
 			Usage:  "start a http server with the API",
 			Action: runServer,
 			Flags:  []cli.Flag{},
 		},
+		{
+			Name:  "export",
+			Usage: "export the data in the database in other formats",
+			Subcommands: []cli.Command{
+				{
+					Name:   "gtfs",
+					Usage:  "write a GTFS static feed (a zip file)",
+					Action: runExportGTFS,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "file to write the feed to",
+							Value: "gtfs.zip",
+						},
+						cli.IntFlag{
+							Name:  "days",
+							Usage: "number of days from today for which the feed is valid",
+							Value: 180,
+						},
+					},
+				},
+			},
+		},
 		{
 			Name:   "apikey",
 			Usage:  "operate on API keys stored in the database",
@@ -55,7 +129,28 @@ func main() {
 				},
 				cli.StringFlag{
 					Name:  "delete, d",
-					Usage: "delete an API key",
+					Usage: "delete an API key (given in full or by the prefix shown by --list)",
+				},
+				cli.StringFlag{
+					Name:  "usage, u",
+					Usage: "show the number of requests made with an API key per route and day",
+				},
+				cli.BoolFlag{
+					Name:  "list, l",
+					Usage: "list all API keys with their metadata",
+				},
+				cli.StringFlag{
+					Name:  "label",
+					Usage: "owner of the new API key",
+				},
+				cli.StringFlag{
+					Name:  "expires",
+					Usage: "date (YYYY-MM-DD) on which the new API key expires",
+				},
+				cli.StringFlag{
+					Name:  "scope",
+					Usage: "comma-separated scopes of the new API key (static, realtime, admin)",
+					Value: "static,realtime",
 				},
 			},
 		},
@@ -89,6 +184,33 @@ func initBackend(config *config.Config) (*backend.Backend, error) {
 	return backend, nil
 }
 
+func initCaptchaSolver(config *config.Config) (realtime.CaptchaSolver, error) {
+	solver, err := realtime.NewCaptchaSolver(
+		config.Parser.CaptchaSolver,
+		config.Parser.CaptchaTemplates,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialise captcha solver: %s", err)
+	}
+
+	return solver, nil
+}
+
+func initCalendar(config *config.Config) (*calendar.Calendar, error) {
+	overrides := make([]*calendar.Override, len(config.Calendar.Overrides))
+	for i, override := range config.Calendar.Overrides {
+		var err error
+		overrides[i], err = calendar.ParseOverride(
+			override.Date, override.DayType, override.Description,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("invalid calendar override for [%s]: %s", override.Date, err)
+		}
+	}
+
+	return calendar.New(overrides), nil
+}
+
 func parseConfig(c *cli.Context) (*config.Config, error) {
 	var err error
 
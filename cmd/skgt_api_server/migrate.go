@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/DexterLB/skgt_api/backend"
+	"github.com/urfave/cli"
+)
+
+func runMigrateUp(c *cli.Context) error {
+	target := backend.LatestSchemaVersion()
+	if c.IsSet("to") {
+		target = c.Int("to")
+	}
+
+	return migrate(c, func(version int) (int, error) {
+		if target < version {
+			return 0, fmt.Errorf("schema version %d is newer than %d", version, target)
+		}
+		return target, nil
+	})
+}
+
+func runMigrateDown(c *cli.Context) error {
+	return migrate(c, func(version int) (int, error) {
+		target := version - 1
+		if c.IsSet("to") {
+			target = c.Int("to")
+		}
+
+		if target > version {
+			return 0, fmt.Errorf("schema version %d is older than %d", version, target)
+		}
+		return target, nil
+	})
+}
+
+// migrate migrates the database to the version returned by getTarget
+// (which is given the current version)
+func migrate(c *cli.Context, getTarget func(version int) (int, error)) error {
+	config, err := parseConfig(c)
+	if err != nil {
+		return err
+	}
+	backend, err := initBackend(config)
+	if err != nil {
+		return err
+	}
+
+	version, err := backend.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	target, err := getTarget(version)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("migrating from schema version %d to %d", version, target)
+	err = backend.Migrate(target)
+	log.Printf("finished migrating")
+
+	if err != nil {
+		return fmt.Errorf("unable to migrate database: %s", err)
+	}
+
+	return nil
+}
+
+func runMigrateStatus(c *cli.Context) error {
+	config, err := parseConfig(c)
+	if err != nil {
+		return err
+	}
+	backend, err := initBackend(config)
+	if err != nil {
+		return err
+	}
+
+	status, err := backend.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range status {
+		applied := "pending"
+		if migration.AppliedAt != nil {
+			applied = migration.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%4d  %-19s  %s\n", migration.Version, applied, migration.Description)
+	}
+
+	return nil
+}
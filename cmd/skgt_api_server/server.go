@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/DexterLB/htmlparsing"
 	"github.com/DexterLB/skgt_api/server"
 	"github.com/urfave/cli"
 )
 
+// shutdownTimeout is how long requests in progress are waited for when
+// the server is stopped
+const shutdownTimeout = 10 * time.Second
+
 func runServer(c *cli.Context) error {
 	config, err := parseConfig(c)
 	if err != nil {
@@ -19,10 +28,53 @@ func runServer(c *cli.Context) error {
 		return err
 	}
 
-	server := server.New(backend, htmlparsing.SensibleSettings())
+	err = backend.CheckSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	solver, err := initCaptchaSolver(config)
+	if err != nil {
+		return err
+	}
+
+	calendar, err := initCalendar(config)
+	if err != nil {
+		return err
+	}
+
+	server := server.New(backend, htmlparsing.SensibleSettings(), solver, calendar, config)
+	httpServer := &http.Server{
+		Addr:    config.Server.ListenAddress,
+		Handler: server,
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		log.Printf("received %s, shutting down", <-signals)
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		err := httpServer.Shutdown(ctx)
+		if err != nil {
+			log.Printf("unable to shut down gracefully: %s", err)
+		}
+	}()
 
 	log.Printf("starting HTTP server on address %s", config.Server.ListenAddress)
-	log.Printf("exit: %s", http.ListenAndServe(config.Server.ListenAddress, server))
+	err = httpServer.ListenAndServe()
+	if err != http.ErrServerClosed {
+		log.Printf("exit: %s", err)
+	} else {
+		<-stopped
+	}
+
+	server.Close()
 
 	return nil
 }
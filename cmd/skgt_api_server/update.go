@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"github.com/DexterLB/htmlparsing"
+	"github.com/DexterLB/skgt_api/backend"
 	"github.com/DexterLB/skgt_api/openstreetmap"
 	"github.com/DexterLB/skgt_api/realtime"
 	"github.com/DexterLB/skgt_api/schedules"
@@ -21,6 +22,11 @@ func runUpdate(c *cli.Context) error {
 		return err
 	}
 
+	err = backend.CheckSchemaVersion()
+	if err != nil {
+		return err
+	}
+
 	log.Printf("parsing timetables")
 	timetables, stopInfos, err := schedules.AllTimetables(
 		htmlparsing.SensibleSettings(),
@@ -56,12 +62,39 @@ func runUpdate(c *cli.Context) error {
 	}
 
 	log.Printf("depositing data to database")
-	err = backend.Fill(stopInfos, timetables)
+	summary, err := backend.Fill(stopInfos, timetables)
 	log.Printf("finished depositing data to database")
 
 	if err != nil {
 		return fmt.Errorf("unable to write data to database: %s", err)
 	}
 
+	if summary.Empty() {
+		fmt.Printf("no changes since dataset version %d\n", summary.Version)
+		return nil
+	}
+
+	fmt.Printf("dataset version %d\n", summary.Version)
+	printChanges("lines", &summary.Lines)
+	printChanges("routes", &summary.Routes)
+	printChanges("stops", &summary.Stops)
+
 	return nil
 }
+
+func printChanges(kind string, changes *backend.Changes) {
+	fmt.Printf(
+		"%s: %d added, %d removed, %d changed\n",
+		kind, len(changes.Added), len(changes.Removed), len(changes.Changed),
+	)
+
+	for _, name := range changes.Added {
+		fmt.Printf("  + %s\n", name)
+	}
+	for _, name := range changes.Removed {
+		fmt.Printf("  - %s\n", name)
+	}
+	for _, name := range changes.Changed {
+		fmt.Printf("  ~ %s\n", name)
+	}
+}
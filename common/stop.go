@@ -4,9 +4,17 @@ package common
 type Stop struct {
 	ID                int
 	Name              string
-	InternationalName string
-	CommunityName     string
+	InternationalName string `db:"international_name"`
+	CommunityName     string `db:"community_name"`
 	Description       string
 	Latitude          float64
 	Longitude         float64
 }
+
+// NearbyStop is a stop together with its distance from some point and the
+// lines which serve it
+type NearbyStop struct {
+	Stop     *Stop
+	Distance float64 // in metres
+	Lines    []*Line
+}
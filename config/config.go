@@ -11,9 +11,11 @@ import (
 
 // Config contains all configuration
 type Config struct {
-	Database Database `toml:"database"`
-	Server   Server   `toml:"server"`
-	Parser   Parser   `toml:"parser"`
+	Database  Database  `toml:"database"`
+	Server    Server    `toml:"server"`
+	Parser    Parser    `toml:"parser"`
+	Collector Collector `toml:"collector"`
+	Calendar  Calendar  `toml:"calendar"`
 }
 
 // Database contains database-related configuration
@@ -29,11 +31,63 @@ type Database struct {
 // Server contains server-related configuration
 type Server struct {
 	ListenAddress string `toml:"listen_address"`
+	// GTFSRealtimeStops are the stops whose arrivals are included in the
+	// GTFS-Realtime feed
+	GTFSRealtimeStops []int `toml:"gtfs_realtime_stops"`
+	// RealtimeCacheSeconds is for how long realtime arrivals are cached
+	RealtimeCacheSeconds int `toml:"realtime_cache_seconds"`
+	// RateLimit is the number of requests per minute allowed for each
+	// API key, and RateLimitBurst is how many of them may be made at once
+	RateLimit      int `toml:"rate_limit"`
+	RateLimitBurst int `toml:"rate_limit_burst"`
+	// RealtimeRateLimit and RealtimeRateLimitBurst are the same for
+	// realtime endpoints, which have a separate limit
+	RealtimeRateLimit      int `toml:"realtime_rate_limit"`
+	RealtimeRateLimitBurst int `toml:"realtime_rate_limit_burst"`
+	// StreamPollSeconds is how often the arrivals of stops with open
+	// streams are polled
+	StreamPollSeconds int `toml:"stream_poll_seconds"`
+	// WebSocketOrigins are the origins (e.g. "https://example.com") of
+	// pages other than the API's own which may open WebSocket connections
+	WebSocketOrigins []string `toml:"websocket_origins"`
+	// UsageFlushSeconds is how often API usage is stored in the database
+	UsageFlushSeconds int `toml:"usage_flush_seconds"`
+	// DailyQuota is the number of requests each API key may make per day
+	// (no quota if 0)
+	DailyQuota int `toml:"daily_quota"`
 }
 
 // Parser contains parser-related configuration
 type Parser struct {
 	ParallelRequests int `toml:"parallel_requests"`
+	// CaptchaSolver is the solver for the virtual board captchas
+	// ("simple" or "template")
+	CaptchaSolver string `toml:"captcha_solver"`
+	// CaptchaTemplates is a directory of labelled captchas for the
+	// template solver
+	CaptchaTemplates string `toml:"captcha_templates"`
+}
+
+// Collector contains configuration for collecting realtime arrivals
+type Collector struct {
+	// Stops are the stops whose arrivals are collected
+	Stops []int `toml:"stops"`
+	// IntervalSeconds is how often the arrivals are collected
+	IntervalSeconds int `toml:"interval_seconds"`
+}
+
+// Calendar contains exceptions to the usual day types
+type Calendar struct {
+	// Overrides are dates on which the operator runs a different schedule
+	// than usual
+	Overrides []CalendarOverride `toml:"overrides"`
+}
+
+// CalendarOverride makes the schedule of some day type run on a date
+type CalendarOverride struct {
+	Date        string `toml:"date"` // YYYY-MM-DD
+	DayType     string `toml:"day_type"`
+	Description string `toml:"description"`
 }
 
 // URN returns a database URN based on the database configuration
@@ -0,0 +1,135 @@
+// Package delays estimates how late realtime arrivals are by matching them
+// to the scheduled stop times.
+package delays
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/realtime"
+	"github.com/DexterLB/skgt_api/schedules"
+)
+
+// MaxEarliness and MaxLateness limit how far a predicted arrival can be from
+// a scheduled one in order for them to be considered the same trip
+const (
+	MaxEarliness = 5 * time.Minute
+	MaxLateness  = 30 * time.Minute
+)
+
+// StopTime is a scheduled arrival of a course at a stop. ServiceDate is the
+// midnight of the service day the course runs on, and Scheduled is the
+// moment of the arrival, which is on the next day for courses which have
+// passed midnight.
+type StopTime struct {
+	Route        uint64
+	DayType      schedules.ScheduleType
+	Course       int
+	Line         common.Line
+	StopID       int
+	StopSequence int
+	ServiceDate  time.Time
+	Scheduled    time.Time
+}
+
+// StopPredictions pairs the realtime arrivals at a stop with the stop times
+// scheduled there
+type StopPredictions struct {
+	StopID    int
+	Arrivals  []*realtime.LineArrivals
+	StopTimes []*StopTime
+}
+
+// Match is a predicted arrival matched to a scheduled stop time
+type Match struct {
+	Arrival  *realtime.Arrival
+	StopTime *StopTime
+}
+
+// Delay returns how late the predicted arrival is
+func (m *Match) Delay() time.Duration {
+	return m.Arrival.Time.Sub(m.StopTime.Scheduled)
+}
+
+// Estimate matches the predicted arrivals at a stop with the stop times
+// scheduled there and returns copies of the arrivals with their scheduled
+// time and delay set. Arrivals which can't be matched are returned
+// unchanged.
+func Estimate(stop *StopPredictions) []*realtime.LineArrivals {
+	matches := make(map[*realtime.Arrival]*Match)
+	for _, match := range MatchStopTimes(stop) {
+		matches[match.Arrival] = match
+	}
+
+	result := make([]*realtime.LineArrivals, len(stop.Arrivals))
+	for i, lineArrivals := range stop.Arrivals {
+		result[i] = &realtime.LineArrivals{
+			Line:     lineArrivals.Line,
+			Arrivals: make([]*realtime.Arrival, len(lineArrivals.Arrivals)),
+		}
+
+		for j, arrival := range lineArrivals.Arrivals {
+			estimated := *arrival
+			if match, ok := matches[arrival]; ok {
+				scheduled := match.StopTime.Scheduled
+				delay := int(math.Round(match.Delay().Minutes()))
+				estimated.ScheduledTime = &scheduled
+				estimated.DelayMinutes = &delay
+			}
+			result[i].Arrivals[j] = &estimated
+		}
+	}
+
+	return result
+}
+
+// MatchStopTimes matches each predicted arrival at a stop to the closest
+// scheduled stop time of the same line, using each stop time at most once
+func MatchStopTimes(stop *StopPredictions) []*Match {
+	var matches []*Match
+
+	for _, lineArrivals := range stop.Arrivals {
+		used := make(map[*StopTime]bool)
+
+		arrivals := make([]*realtime.Arrival, len(lineArrivals.Arrivals))
+		copy(arrivals, lineArrivals.Arrivals)
+		sort.Slice(arrivals, func(i, j int) bool {
+			return arrivals[i].Time.Before(arrivals[j].Time)
+		})
+
+		for _, arrival := range arrivals {
+			var best *Match
+			for _, stopTime := range stop.StopTimes {
+				if used[stopTime] || stopTime.Line != *lineArrivals.Line {
+					continue
+				}
+
+				match := &Match{Arrival: arrival, StopTime: stopTime}
+				delay := match.Delay()
+				if delay < -MaxEarliness || delay > MaxLateness {
+					continue
+				}
+
+				if best == nil || abs(delay) < abs(best.Delay()) {
+					best = match
+				}
+			}
+
+			if best != nil {
+				used[best.StopTime] = true
+				matches = append(matches, best)
+			}
+		}
+	}
+
+	return matches
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
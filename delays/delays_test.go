@@ -0,0 +1,130 @@
+package delays
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/realtime"
+)
+
+func TestEstimate(t *testing.T) {
+	line := common.Line{Vehicle: common.Tram, Number: "10"}
+	calculated := time.Date(2017, 3, 14, 11, 58, 0, 0, time.UTC)
+	serviceDate := time.Date(2017, 3, 14, 0, 0, 0, 0, time.UTC)
+
+	arrivals := []*realtime.LineArrivals{
+		&realtime.LineArrivals{
+			Line: &line,
+			Arrivals: []*realtime.Arrival{
+				&realtime.Arrival{
+					Time:       time.Date(2017, 3, 14, 12, 32, 0, 0, time.UTC),
+					Calculated: calculated,
+				},
+				&realtime.Arrival{
+					Time:       time.Date(2017, 3, 14, 12, 27, 0, 0, time.UTC),
+					Calculated: calculated,
+				},
+				// too far from anything on the schedule
+				&realtime.Arrival{
+					Time:       time.Date(2017, 3, 14, 16, 0, 0, 0, time.UTC),
+					Calculated: calculated,
+				},
+			},
+		},
+	}
+
+	estimated := Estimate(&StopPredictions{
+		StopID:   2,
+		Arrivals: arrivals,
+		StopTimes: []*StopTime{
+			&StopTime{
+				Route: 1, Course: 1, Line: line, StopID: 2, StopSequence: 2,
+				ServiceDate: serviceDate,
+				Scheduled:   time.Date(2017, 3, 14, 12, 30, 0, 0, time.UTC),
+			},
+			&StopTime{
+				Route: 1, Course: 2, Line: line, StopID: 2, StopSequence: 2,
+				ServiceDate: serviceDate,
+				Scheduled:   time.Date(2017, 3, 14, 12, 35, 0, 0, time.UTC),
+			},
+		},
+	})
+
+	for i, expected := range []struct {
+		scheduled *time.Time
+		delay     int
+	}{
+		{timePointer(time.Date(2017, 3, 14, 12, 35, 0, 0, time.UTC)), -3},
+		{timePointer(time.Date(2017, 3, 14, 12, 30, 0, 0, time.UTC)), -3},
+		{nil, 0},
+	} {
+		arrival := estimated[0].Arrivals[i]
+
+		if expected.scheduled == nil {
+			if arrival.ScheduledTime != nil || arrival.DelayMinutes != nil {
+				t.Errorf("arrival %d was matched to %s", i, arrival.ScheduledTime)
+			}
+			continue
+		}
+
+		if arrival.ScheduledTime == nil || !arrival.ScheduledTime.Equal(*expected.scheduled) {
+			t.Errorf("arrival %d was matched to %v instead of %s", i, arrival.ScheduledTime, expected.scheduled)
+		}
+		if arrival.DelayMinutes == nil || *arrival.DelayMinutes != expected.delay {
+			t.Errorf("wrong delay for arrival %d: %v instead of %d", i, arrival.DelayMinutes, expected.delay)
+		}
+	}
+
+	if arrivals[0].Arrivals[0].ScheduledTime != nil {
+		t.Errorf("the original arrivals were changed")
+	}
+}
+
+func TestMatchStopTimes_ServiceDays(t *testing.T) {
+	line := common.Line{Vehicle: common.Bus, Number: "N1"}
+	yesterday := time.Date(2017, 3, 14, 0, 0, 0, 0, time.UTC)
+	today := time.Date(2017, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	// the same course on two service days: yesterday's has passed midnight
+	// and is the one arriving now
+	stopTimes := []*StopTime{
+		&StopTime{
+			Route: 1, Course: 1, Line: line, StopID: 2, StopSequence: 3,
+			ServiceDate: yesterday,
+			Scheduled:   time.Date(2017, 3, 15, 0, 10, 0, 0, time.UTC),
+		},
+		&StopTime{
+			Route: 1, Course: 1, Line: line, StopID: 2, StopSequence: 3,
+			ServiceDate: today,
+			Scheduled:   time.Date(2017, 3, 16, 0, 10, 0, 0, time.UTC),
+		},
+	}
+
+	matches := MatchStopTimes(&StopPredictions{
+		StopID: 2,
+		Arrivals: []*realtime.LineArrivals{
+			&realtime.LineArrivals{
+				Line: &line,
+				Arrivals: []*realtime.Arrival{
+					&realtime.Arrival{Time: time.Date(2017, 3, 15, 0, 12, 0, 0, time.UTC)},
+				},
+			},
+		},
+		StopTimes: stopTimes,
+	})
+
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(matches))
+	}
+	if matches[0].StopTime != stopTimes[0] {
+		t.Errorf("matched to the course of %s", matches[0].StopTime.ServiceDate)
+	}
+	if delay := matches[0].Delay(); delay != 2*time.Minute {
+		t.Errorf("wrong delay: %s", delay)
+	}
+}
+
+func timePointer(t time.Time) *time.Time {
+	return &t
+}
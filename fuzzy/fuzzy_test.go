@@ -0,0 +1,64 @@
+package fuzzy
+
+import "testing"
+
+func TestTransliterate(t *testing.T) {
+	for input, expected := range map[string]string{
+		"Света Неделя":      "sveta nedelya",
+		"София":             "sofia",
+		"Ж.к. Младост 1":    "zh.k. mladost 1",
+		"Щастие и тъга":     "shtastie i taga",
+		"Гара Подуяне":      "gara poduyane",
+		"Ситняково":         "sitnyakovo",
+		"already latin 123": "already latin 123",
+	} {
+		if actual := Transliterate(input); actual != expected {
+			t.Errorf("%s transliterated as %s instead of %s", input, actual, expected)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	matching := []struct {
+		query     string
+		candidate string
+	}{
+		{"Sveta Nedelya", "ПЛ. СВЕТА НЕДЕЛЯ"},
+		{"sveta nedelia", "пл. Света Неделя"},
+		{"света неделя", "ПЛ. СВЕТА НЕДЕЛЯ"},
+		{"свта неделя", "ПЛ. СВЕТА НЕДЕЛЯ"},
+		{"mladost", "Ж.К. МЛАДОСТ 1"},
+		{"младо", "Ж.К. МЛАДОСТ 1"},
+		{"Sofia", "Гара София"},
+		// letters which aren't transliterated take more than a byte
+		{"kafe", "Káfeteria"},
+	}
+
+	for _, m := range matching {
+		if Score(m.query, m.candidate) == 0 {
+			t.Errorf("%s doesn't match %s", m.query, m.candidate)
+		}
+	}
+
+	notMatching := []struct {
+		query     string
+		candidate string
+	}{
+		{"Sveta Nedelya", "ПЛ. МАКЕДОНИЯ"},
+		{"люлин", "Ж.К. МЛАДОСТ 1"},
+		{"", "Ж.К. МЛАДОСТ 1"},
+	}
+
+	for _, m := range notMatching {
+		if Score(m.query, m.candidate) != 0 {
+			t.Errorf("%s matches %s", m.query, m.candidate)
+		}
+	}
+
+	exact := Score("Sveta Nedelya", "Света Неделя")
+	typo := Score("Sveta Nedelya", "Света Недела")
+	longer := Score("Sveta Nedelya", "Метростанция Света Неделя")
+	if !(exact > typo && exact > longer) {
+		t.Errorf("exact match scored lower than inexact ones: %f, %f, %f", exact, typo, longer)
+	}
+}
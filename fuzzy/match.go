@@ -0,0 +1,120 @@
+package fuzzy
+
+import "strings"
+
+// Score returns how well the query matches the candidate, from 0 (not at
+// all) to 1 (exactly). Every word of the query must match (possibly with
+// typos) the start of some word in the candidate.
+func Score(query string, candidate string) float64 {
+	queryWords := Normalise(query)
+	candidateWords := Normalise(candidate)
+	if len(queryWords) == 0 || len(candidateWords) == 0 {
+		return 0
+	}
+
+	total := 0.0
+	for _, queryWord := range queryWords {
+		best := 0.0
+		for _, candidateWord := range candidateWords {
+			if score := wordScore(queryWord, candidateWord); score > best {
+				best = score
+			}
+		}
+
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+
+	score := total / float64(len(queryWords))
+
+	// prefer candidates which don't have many more words than the query
+	if len(candidateWords) > len(queryWords) {
+		score *= 0.95
+	}
+
+	return score
+}
+
+// wordScore compares a single word of the query to a single word of the
+// candidate
+func wordScore(query string, candidate string) float64 {
+	if query == candidate {
+		return 1
+	}
+
+	if strings.HasPrefix(candidate, query) {
+		return 0.9
+	}
+
+	// the query word may be an incomplete and misspelled version of the
+	// candidate word, so compare it to a prefix of the same length too
+	prefix := []rune(candidate)
+	if length := len([]rune(query)); len(prefix) > length {
+		prefix = prefix[:length]
+	}
+
+	distance := levenshtein(query, candidate)
+	if prefixDistance := levenshtein(query, string(prefix)); prefixDistance < distance {
+		distance = prefixDistance
+	}
+
+	if distance > tolerance(query) {
+		return 0
+	}
+
+	return 0.8 - 0.1*float64(distance)
+}
+
+// tolerance returns the number of typos allowed in a word
+func tolerance(word string) int {
+	switch n := len([]rune(word)); {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			current[j] = minimum(
+				previous[j]+1,
+				current[j-1]+1,
+				previous[j-1]+cost,
+			)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+func minimum(first int, rest ...int) int {
+	result := first
+	for _, x := range rest {
+		if x < result {
+			result = x
+		}
+	}
+	return result
+}
@@ -0,0 +1,51 @@
+// Package fuzzy implements typo-tolerant matching of names which may be
+// written either in Cyrillic or in Latin script.
+package fuzzy
+
+import (
+	"strings"
+	"unicode"
+)
+
+// transliterations follow the Bulgarian Streamlined System, which is the
+// official transliteration used on street signs
+var transliterations = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n",
+	'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f",
+	'х': "h", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "sht", 'ъ': "a",
+	'ь': "y", 'ю': "yu", 'я': "ya",
+}
+
+// Transliterate converts the Bulgarian Cyrillic letters in the given string
+// to Latin ones, lowercasing everything
+func Transliterate(input string) string {
+	runes := []rune(strings.ToLower(input))
+	result := &strings.Builder{}
+
+	for i := 0; i < len(runes); i++ {
+		// "ия" at the end of a word is written as "ia" (e.g. София -> Sofia)
+		if runes[i] == 'и' && i+1 < len(runes) && runes[i+1] == 'я' &&
+			(i+2 == len(runes) || !unicode.IsLetter(runes[i+2])) {
+			result.WriteString("ia")
+			i++
+			continue
+		}
+
+		if latin, ok := transliterations[runes[i]]; ok {
+			result.WriteString(latin)
+		} else {
+			result.WriteRune(runes[i])
+		}
+	}
+
+	return result.String()
+}
+
+// Normalise transliterates the given string and splits it into words,
+// dropping any punctuation
+func Normalise(input string) []string {
+	return strings.FieldsFunc(Transliterate(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,84 @@
+// Package gtfs contains helpers for exporting transport data in the
+// General Transit Feed Specification format (https://gtfs.org/).
+package gtfs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/schedules"
+)
+
+const (
+	// AgencyID is the ID of the only agency in the feed
+	AgencyID = "sofiatraffic"
+	// AgencyName is the human-readable name of the agency
+	AgencyName = "Център за градска мобилност"
+	// AgencyURL is the website of the agency
+	AgencyURL = "https://www.sofiatraffic.bg/"
+	// AgencyTimezone is the timezone in which all times in the feed are given
+	AgencyTimezone = "Europe/Sofia"
+	// AgencyLang is the language of all names in the feed
+	AgencyLang = "bg"
+)
+
+// Exception types in calendar_dates.txt
+const (
+	// ServiceAdded means that a service runs on a date
+	ServiceAdded = 1
+	// ServiceRemoved means that a service doesn't run on a date
+	ServiceRemoved = 2
+)
+
+// StopID returns the GTFS stop_id for a stop
+func StopID(stopID int) string {
+	return fmt.Sprintf("%d", stopID)
+}
+
+// RouteID returns the GTFS route_id for a line (GTFS routes correspond to
+// our lines, not to our routes)
+func RouteID(line *common.Line) string {
+	return fmt.Sprintf("%s-%s", strings.ToLower(line.Vehicle.String()), line.Number)
+}
+
+// ServiceID returns the GTFS service_id for a day type
+func ServiceID(dayType schedules.ScheduleType) string {
+	return strings.ToLower(dayType.String())
+}
+
+// TripID returns the GTFS trip_id for a single course of a route
+func TripID(routeID uint64, dayType schedules.ScheduleType, course int) string {
+	return fmt.Sprintf("%d-%d-%d", routeID, dayType, course)
+}
+
+// RouteType returns the GTFS route_type for a vehicle type
+func RouteType(vehicle common.VehicleType) int {
+	switch vehicle {
+	case common.Tram:
+		return 0
+	case common.Subway:
+		return 1
+	case common.Trolley:
+		return 11
+	default:
+		return 3
+	}
+}
+
+// Weekdays returns on which days of the week (starting from monday) a given
+// day type is in effect
+func Weekdays(dayType schedules.ScheduleType) [7]bool {
+	workday := dayType&schedules.Workday != 0
+	return [7]bool{
+		workday, workday, workday, workday, workday,
+		dayType&schedules.PreHoliday != 0,
+		dayType&schedules.Holiday != 0,
+	}
+}
+
+// FormatTime formats a number of minutes since midnight as a GTFS time
+// (which can be more than 24:00:00 for trips after midnight)
+func FormatTime(minutes int) string {
+	return fmt.Sprintf("%02d:%02d:00", minutes/60, minutes%60)
+}
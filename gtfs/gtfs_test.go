@@ -0,0 +1,90 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/schedules"
+)
+
+func TestIDs(t *testing.T) {
+	if id := RouteID(&common.Line{Vehicle: common.Tram, Number: "10"}); id != "tram-10" {
+		t.Errorf("wrong route id: %s", id)
+	}
+
+	if id := ServiceID(schedules.HolidayAndPreHoliday); id != "holidayandpreholiday" {
+		t.Errorf("wrong service id: %s", id)
+	}
+
+	if id := TripID(42, schedules.Workday, 3); id != "42-1-3" {
+		t.Errorf("wrong trip id: %s", id)
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	for minutes, expected := range map[int]string{
+		0:        "00:00:00",
+		8*60 + 5: "08:05:00",
+		25 * 60:  "25:00:00",
+	} {
+		if actual := FormatTime(minutes); actual != expected {
+			t.Errorf("%d minutes formatted as %s instead of %s", minutes, actual, expected)
+		}
+	}
+}
+
+func TestWeekdays(t *testing.T) {
+	expected := [7]bool{false, false, false, false, false, true, true}
+	if actual := Weekdays(schedules.HolidayAndPreHoliday); actual != expected {
+		t.Errorf("wrong weekdays: %v", actual)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	feed := NewWriter(buf)
+
+	f, err := feed.File("agency.txt", "agency_id", "agency_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Write([]string{AgencyID, AgencyName})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = feed.File("stops.txt", "stop_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = feed.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(archive.File) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(archive.File))
+	}
+
+	r, err := archive.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records[1][1] != AgencyName {
+		t.Errorf("wrong agency.txt contents: %v", records)
+	}
+}
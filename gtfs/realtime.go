@@ -0,0 +1,92 @@
+package gtfs
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	// the agency's timezone must be available even on systems without
+	// a timezone database
+	_ "time/tzdata"
+
+	"github.com/DexterLB/skgt_api/delays"
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// Location is the timezone in which the agency's schedules are given
+var Location = mustLoadLocation(AgencyTimezone)
+
+// TripUpdates builds a GTFS-Realtime feed which contains a trip update for
+// each scheduled trip which at least one predicted arrival is matched to.
+// A trip runs once per service day, so updates are kept apart by start date.
+func TripUpdates(predictions []*delays.StopPredictions, now time.Time) *gtfsrt.FeedMessage {
+	updates := make(map[string]*gtfsrt.TripUpdate)
+
+	for _, stop := range predictions {
+		for _, match := range delays.MatchStopTimes(stop) {
+			stopTime := match.StopTime
+			tripID := TripID(stopTime.Route, stopTime.DayType, stopTime.Course)
+			startDate := stopTime.ServiceDate.Format("20060102")
+			key := tripID + "-" + startDate
+
+			update, ok := updates[key]
+			if !ok {
+				update = &gtfsrt.TripUpdate{
+					Trip: &gtfsrt.TripDescriptor{
+						TripId:    proto.String(tripID),
+						RouteId:   proto.String(RouteID(&stopTime.Line)),
+						StartDate: proto.String(startDate),
+					},
+					Timestamp: proto.Uint64(uint64(match.Arrival.Calculated.Unix())),
+				}
+				updates[key] = update
+			}
+
+			update.StopTimeUpdate = append(update.StopTimeUpdate, &gtfsrt.TripUpdate_StopTimeUpdate{
+				StopSequence: proto.Uint32(uint32(stopTime.StopSequence)),
+				StopId:       proto.String(StopID(stopTime.StopID)),
+				Arrival: &gtfsrt.TripUpdate_StopTimeEvent{
+					Time:  proto.Int64(match.Arrival.Time.Unix()),
+					Delay: proto.Int32(int32(match.Delay().Seconds())),
+				},
+			})
+		}
+	}
+
+	keys := make([]string, 0, len(updates))
+	for key := range updates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Incrementality:      gtfsrt.FeedHeader_FULL_DATASET.Enum(),
+			Timestamp:           proto.Uint64(uint64(now.Unix())),
+		},
+	}
+
+	for _, key := range keys {
+		update := updates[key]
+		sort.Slice(update.StopTimeUpdate, func(i, j int) bool {
+			return update.StopTimeUpdate[i].GetStopSequence() < update.StopTimeUpdate[j].GetStopSequence()
+		})
+
+		feed.Entity = append(feed.Entity, &gtfsrt.FeedEntity{
+			Id:         proto.String(key),
+			TripUpdate: update,
+		})
+	}
+
+	return feed
+}
+
+// mustLoadLocation loads a timezone, panicking if it doesn't exist
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		panic(fmt.Sprintf("unable to load timezone %s: %s", name, err))
+	}
+	return location
+}
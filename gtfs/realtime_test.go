@@ -0,0 +1,192 @@
+package gtfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/delays"
+	"github.com/DexterLB/skgt_api/realtime"
+	"github.com/DexterLB/skgt_api/schedules"
+)
+
+func TestTripUpdates(t *testing.T) {
+	line := common.Line{Vehicle: common.Tram, Number: "10"}
+	calculated := time.Date(2017, 3, 14, 11, 58, 0, 0, Location)
+	serviceDate := time.Date(2017, 3, 14, 0, 0, 0, 0, Location)
+
+	predictions := []*delays.StopPredictions{
+		&delays.StopPredictions{
+			StopID: 2,
+			Arrivals: []*realtime.LineArrivals{
+				&realtime.LineArrivals{
+					Line: &line,
+					Arrivals: []*realtime.Arrival{
+						&realtime.Arrival{
+							Time:       time.Date(2017, 3, 14, 13, 33, 0, 0, Location),
+							Calculated: calculated,
+						},
+						&realtime.Arrival{
+							Time:       time.Date(2017, 3, 14, 12, 32, 0, 0, Location),
+							Calculated: calculated,
+						},
+						// too far from anything on the schedule
+						&realtime.Arrival{
+							Time:       time.Date(2017, 3, 14, 16, 0, 0, 0, Location),
+							Calculated: calculated,
+						},
+					},
+				},
+			},
+			StopTimes: []*delays.StopTime{
+				stopTime(1, 1, line, 2, serviceDate, 12, 30),
+				stopTime(1, 2, line, 2, serviceDate, 13, 30),
+				stopTime(2, 1, common.Line{Vehicle: common.Bus, Number: "10"}, 1, serviceDate, 16, 0),
+			},
+		},
+	}
+
+	feed := TripUpdates(predictions, calculated)
+
+	if len(feed.Entity) != 2 {
+		t.Fatalf("expected 2 trip updates, got %d", len(feed.Entity))
+	}
+
+	for i, expected := range []struct {
+		tripID string
+		delay  int32
+	}{
+		{"1-1-1", 120},
+		{"1-1-2", 180},
+	} {
+		update := feed.Entity[i].TripUpdate
+		if update.Trip.GetTripId() != expected.tripID {
+			t.Errorf("wrong trip id: %s instead of %s", update.Trip.GetTripId(), expected.tripID)
+		}
+		if update.Trip.GetRouteId() != "tram-10" {
+			t.Errorf("wrong route id: %s", update.Trip.GetRouteId())
+		}
+		if len(update.StopTimeUpdate) != 1 {
+			t.Fatalf("expected 1 stop time update, got %d", len(update.StopTimeUpdate))
+		}
+		if delay := update.StopTimeUpdate[0].Arrival.GetDelay(); delay != expected.delay {
+			t.Errorf("wrong delay for %s: %d instead of %d", expected.tripID, delay, expected.delay)
+		}
+	}
+}
+
+func TestTripUpdates_PastMidnight(t *testing.T) {
+	line := common.Line{Vehicle: common.Bus, Number: "N1"}
+	calculated := time.Date(2017, 3, 15, 0, 5, 0, 0, Location)
+	yesterday := time.Date(2017, 3, 14, 0, 0, 0, 0, Location)
+	today := time.Date(2017, 3, 15, 0, 0, 0, 0, Location)
+
+	predictions := []*delays.StopPredictions{
+		&delays.StopPredictions{
+			StopID: 2,
+			Arrivals: []*realtime.LineArrivals{
+				&realtime.LineArrivals{
+					Line: &line,
+					Arrivals: []*realtime.Arrival{
+						&realtime.Arrival{
+							Time:       time.Date(2017, 3, 15, 0, 12, 0, 0, Location),
+							Calculated: calculated,
+						},
+						&realtime.Arrival{
+							Time:       time.Date(2017, 3, 15, 0, 42, 0, 0, Location),
+							Calculated: calculated,
+						},
+					},
+				},
+			},
+			StopTimes: []*delays.StopTime{
+				// course 1 starts before midnight and course 2 after it,
+				// and both run on each service day
+				stopTime(1, 1, line, 3, yesterday, 24, 10),
+				stopTime(1, 2, line, 3, yesterday, 0, 40),
+				stopTime(1, 1, line, 3, today, 24, 10),
+				stopTime(1, 2, line, 3, today, 0, 40),
+			},
+		},
+	}
+
+	feed := TripUpdates(predictions, calculated)
+	if len(feed.Entity) != 2 {
+		t.Fatalf("expected 2 trip updates, got %d", len(feed.Entity))
+	}
+
+	for i, expected := range []struct {
+		tripID    string
+		startDate string
+	}{
+		{"1-1-1", "20170314"},
+		{"1-1-2", "20170315"},
+	} {
+		trip := feed.Entity[i].TripUpdate.Trip
+		if trip.GetTripId() != expected.tripID || trip.GetStartDate() != expected.startDate {
+			t.Errorf(
+				"trip %d is %s on %s instead of %s on %s", i,
+				trip.GetTripId(), trip.GetStartDate(), expected.tripID, expected.startDate,
+			)
+		}
+	}
+}
+
+func TestTripUpdates_ServiceDays(t *testing.T) {
+	line := common.Line{Vehicle: common.Bus, Number: "N1"}
+	calculated := time.Date(2017, 3, 15, 0, 5, 0, 0, Location)
+	yesterday := time.Date(2017, 3, 14, 0, 0, 0, 0, Location)
+	today := time.Date(2017, 3, 15, 0, 0, 0, 0, Location)
+
+	// the same trip is matched on both service days
+	predictions := []*delays.StopPredictions{
+		&delays.StopPredictions{
+			StopID: 2,
+			Arrivals: []*realtime.LineArrivals{
+				&realtime.LineArrivals{
+					Line: &line,
+					Arrivals: []*realtime.Arrival{
+						&realtime.Arrival{
+							Time:       time.Date(2017, 3, 15, 0, 1, 0, 0, Location),
+							Calculated: calculated,
+						},
+						&realtime.Arrival{
+							Time:       time.Date(2017, 3, 15, 0, 21, 0, 0, Location),
+							Calculated: calculated,
+						},
+					},
+				},
+			},
+			StopTimes: []*delays.StopTime{
+				stopTime(1, 1, line, 3, yesterday, 24, 0),
+				stopTime(1, 1, line, 3, today, 0, 20),
+			},
+		},
+	}
+
+	feed := TripUpdates(predictions, calculated)
+	if len(feed.Entity) != 2 {
+		t.Fatalf("expected 2 trip updates, got %d", len(feed.Entity))
+	}
+	if feed.Entity[0].GetId() == feed.Entity[1].GetId() {
+		t.Errorf("both trip updates have the id %s", feed.Entity[0].GetId())
+	}
+}
+
+// stopTime returns a workday stop time of a course on a service day, where
+// hours past 24 are on the next day
+func stopTime(
+	route uint64, course int, line common.Line, sequence int,
+	serviceDate time.Time, hours int, minutes int,
+) *delays.StopTime {
+	return &delays.StopTime{
+		Route:        route,
+		DayType:      schedules.Workday,
+		Course:       course,
+		Line:         line,
+		StopID:       2,
+		StopSequence: sequence,
+		ServiceDate:  serviceDate,
+		Scheduled:    serviceDate.Add(time.Duration(hours*60+minutes) * time.Minute),
+	}
+}
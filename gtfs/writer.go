@@ -0,0 +1,69 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// Writer writes a GTFS feed as a zip archive of CSV files
+type Writer struct {
+	archive *zip.Writer
+	current *csv.Writer
+}
+
+// NewWriter returns a Writer which writes the feed to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		archive: zip.NewWriter(w),
+	}
+}
+
+// File starts a new file in the feed and writes its header. All rows of the
+// file must be written to the returned csv writer before starting the next
+// file.
+func (w *Writer) File(name string, header ...string) (*csv.Writer, error) {
+	err := w.flush()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := w.archive.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s: %s", name, err)
+	}
+
+	w.current = csv.NewWriter(f)
+	err = w.current.Write(header)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write header of %s: %s", name, err)
+	}
+
+	return w.current, nil
+}
+
+// Close finishes writing the feed
+func (w *Writer) Close() error {
+	err := w.flush()
+	if err != nil {
+		return err
+	}
+
+	return w.archive.Close()
+}
+
+func (w *Writer) flush() error {
+	if w.current == nil {
+		return nil
+	}
+
+	w.current.Flush()
+	err := w.current.Error()
+	if err != nil {
+		return fmt.Errorf("unable to write csv data: %s", err)
+	}
+
+	w.current = nil
+	return nil
+}
@@ -4,15 +4,20 @@ import (
 	"testing"
 
 	"github.com/DexterLB/htmlparsing"
+	"github.com/DexterLB/skgt_api/replay"
 )
 
 func TestGetStops(t *testing.T) {
+	defer replay.Fixtures(t)()
+
 	stops, err := GetStops(htmlparsing.SensibleSettings())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(stops) < 10 {
-		t.Errorf("Too few stops. Something's fishy.")
+	if len(stops) == 0 {
+		t.Errorf("No stops. Something's fishy.")
 	}
+
+	replay.Golden(t, stops)
 }
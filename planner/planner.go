@@ -0,0 +1,488 @@
+// Package planner finds journeys between stops over the static timetable
+// with the Connection Scan Algorithm. The whole timetable for a day type
+// is kept in memory, so queries don't touch the database.
+package planner
+
+import (
+	"math"
+	"sort"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/schedules"
+)
+
+const (
+	// MaxWalkDistance is the longest walk between two stops (in metres)
+	MaxWalkDistance = 400
+	// WalkingSpeed is in metres per minute
+	WalkingSpeed = 75
+	// TransferMinutes is the shortest time in which one can change vehicles
+	// at the same stop
+	TransferMinutes = 1
+)
+
+// Connection is a vehicle going from a stop to the next one on its trip.
+// Times are in minutes since the start of the service day and can be more
+// than 24 hours for trips which run past midnight.
+type Connection struct {
+	TripID    string
+	Line      common.Line
+	Direction string
+	From      int
+	To        int
+	Departure int
+	Arrival   int
+}
+
+// Leg is a part of an itinerary: either a ride on a single vehicle or a
+// walk between two nearby stops (in which case Line is nil)
+type Leg struct {
+	Line      *common.Line
+	Direction string
+	From      *common.Stop
+	To        *common.Stop
+	Departure *schedules.Time
+	Arrival   *schedules.Time
+	Stops     int     // number of stops travelled, 0 for walks
+	Distance  float64 // in metres, 0 for rides
+}
+
+// Itinerary is a way to get from one stop to another
+type Itinerary struct {
+	Departure *schedules.Time
+	Arrival   *schedules.Time
+	Duration  int // in minutes
+	Transfers int
+	Legs      []*Leg
+}
+
+// Planner plans journeys over the timetable of a single day type
+type Planner struct {
+	// connections are sorted by departure
+	connections []*Connection
+	// trips contains the index of each connection's trip
+	trips     []int
+	tripCount int
+
+	stops     map[int]*common.Stop
+	footpaths map[int][]*footpath
+}
+
+// footpath is a walk from a stop to a nearby one
+type footpath struct {
+	to       int
+	distance float64
+	duration int // in minutes
+}
+
+// New returns a planner over the given connections. Footpaths are added
+// between all stops which are at most MaxWalkDistance apart.
+func New(stops []*common.Stop, connections []*Connection) *Planner {
+	p := &Planner{
+		connections: make([]*Connection, len(connections)),
+		trips:       make([]int, len(connections)),
+		stops:       make(map[int]*common.Stop, len(stops)),
+		footpaths:   make(map[int][]*footpath),
+	}
+
+	copy(p.connections, connections)
+	sort.SliceStable(p.connections, func(i, j int) bool {
+		a, b := p.connections[i], p.connections[j]
+		if a.Departure != b.Departure {
+			return a.Departure < b.Departure
+		}
+		return a.Arrival < b.Arrival
+	})
+
+	tripIndices := make(map[string]int)
+	for i, connection := range p.connections {
+		index, ok := tripIndices[connection.TripID]
+		if !ok {
+			index = len(tripIndices)
+			tripIndices[connection.TripID] = index
+		}
+		p.trips[i] = index
+	}
+	p.tripCount = len(tripIndices)
+
+	for _, stop := range stops {
+		p.stops[stop.ID] = stop
+	}
+	p.addFootpaths(stops)
+
+	return p
+}
+
+// addFootpaths finds the pairs of stops which are close enough to walk
+// between. Stops without coordinates are skipped.
+func (p *Planner) addFootpaths(stops []*common.Stop) {
+	var located []*common.Stop
+	for _, stop := range stops {
+		if stop.Latitude != 0 || stop.Longitude != 0 {
+			located = append(located, stop)
+		}
+	}
+
+	sort.Slice(located, func(i, j int) bool {
+		return located[i].Latitude < located[j].Latitude
+	})
+
+	// a degree of latitude is always about 111km, so only stops with close
+	// enough latitudes need to be compared
+	maxLatitude := MaxWalkDistance / (earthRadius * math.Pi / 180)
+
+	for i, a := range located {
+		for _, b := range located[i+1:] {
+			if b.Latitude-a.Latitude > maxLatitude {
+				break
+			}
+
+			d := distance(a, b)
+			if d > MaxWalkDistance {
+				continue
+			}
+
+			duration := int(math.Ceil(d / WalkingSpeed))
+			if duration < 1 {
+				duration = 1
+			}
+
+			p.footpaths[a.ID] = append(p.footpaths[a.ID], &footpath{b.ID, d, duration})
+			p.footpaths[b.ID] = append(p.footpaths[b.ID], &footpath{a.ID, d, duration})
+		}
+	}
+}
+
+// HasStop checks if the planner knows about a stop
+func (p *Planner) HasStop(stopID int) bool {
+	_, ok := p.stops[stopID]
+	return ok
+}
+
+// FirstDeparture returns the earliest departure of any connection (in
+// minutes since the start of the service day), or 0 if there are none
+func (p *Planner) FirstDeparture() int {
+	if len(p.connections) == 0 {
+		return 0
+	}
+	return p.connections[0].Departure
+}
+
+// Plan returns at most count itineraries from one stop to another which
+// depart at or after the given time (in minutes since the start of the
+// service day) and take at most maxMinutes. Each itinerary departs later
+// than the previous one.
+func (p *Planner) Plan(from int, to int, depart int, maxMinutes int, count int) []*Itinerary {
+	var itineraries []*Itinerary
+
+	for len(itineraries) < count {
+		labels := p.scan(from, depart, depart+maxMinutes, to)
+		arrival, ok := labels.arrival[to]
+		if !ok {
+			break
+		}
+
+		itinerary := p.itinerary(arrival)
+
+		// an itinerary which departs later and arrives at the same time
+		// is better than the previous one
+		n := len(itineraries)
+		if n > 0 && minutes(itineraries[n-1].Arrival) == minutes(itinerary.Arrival) {
+			itineraries[n-1] = itinerary
+		} else {
+			itineraries = append(itineraries, itinerary)
+		}
+
+		ride := firstRide(arrival)
+		if ride == nil {
+			// walking is always possible, so there are no other itineraries
+			break
+		}
+		depart = ride.board.Departure + 1
+	}
+
+	return itineraries
+}
+
+// Reach is the earliest arrival at a stop from some origin
+type Reach struct {
+	Stop      *common.Stop
+	Arrival   *schedules.Time
+	Minutes   int // since the departure from the origin
+	Transfers int
+}
+
+// Reachable returns the stops which can be reached from a stop within
+// maxMinutes when departing at the given time (in minutes since the start
+// of the service day), ordered by arrival. The origin itself is included.
+func (p *Planner) Reachable(from int, depart int, maxMinutes int) []*Reach {
+	labels := p.scan(from, depart, depart+maxMinutes, -1)
+
+	reachable := make([]*Reach, 0, len(labels.arrival))
+	for stopID, arrival := range labels.arrival {
+		rides := 0
+		for s := arrival; s.prev != nil; s = s.prev {
+			if s.board != nil {
+				rides++
+			}
+		}
+
+		reach := &Reach{
+			Stop:    p.stop(stopID),
+			Arrival: clock(arrival.time),
+			Minutes: arrival.time - depart,
+		}
+		if rides > 1 {
+			reach.Transfers = rides - 1
+		}
+
+		reachable = append(reachable, reach)
+	}
+
+	sort.Slice(reachable, func(i, j int) bool {
+		if reachable[i].Minutes != reachable[j].Minutes {
+			return reachable[i].Minutes < reachable[j].Minutes
+		}
+		return reachable[i].Stop.ID < reachable[j].Stop.ID
+	})
+
+	return reachable
+}
+
+// step is the last leg of a journey to a stop. Steps form linked lists
+// (via prev) which lead back to the origin.
+type step struct {
+	prev *step
+	stop int
+	time int // arrival at stop
+
+	// board and alight are the first and last connections of rides
+	board  *Connection
+	alight *Connection
+	stops  int
+
+	// distance is only set for walks
+	distance float64
+}
+
+// ready returns the earliest time at which another vehicle can be boarded
+// after the step
+func (s *step) ready() int {
+	if s.alight != nil {
+		return s.time + TransferMinutes
+	}
+	return s.time
+}
+
+// labels are the best known journeys to each stop
+type labels struct {
+	// arrival is the earliest arrival
+	arrival map[int]*step
+	// ride is the earliest arrival with a vehicle (after which one can walk)
+	ride map[int]*step
+	// ready is the step after which a vehicle can be boarded the earliest
+	ready map[int]*step
+}
+
+func (l *labels) improve(s *step) {
+	if best, ok := l.arrival[s.stop]; !ok || s.time < best.time {
+		l.arrival[s.stop] = s
+	}
+	if best, ok := l.ready[s.stop]; !ok || s.ready() < best.ready() {
+		l.ready[s.stop] = s
+	}
+}
+
+// scan finds the earliest arrivals at all stops which can be reached from
+// the origin by the given time. If target is a stop, the scan stops as
+// soon as no better journey to it is possible.
+func (p *Planner) scan(origin int, depart int, until int, target int) *labels {
+	l := &labels{
+		arrival: make(map[int]*step),
+		ride:    make(map[int]*step),
+		ready:   make(map[int]*step),
+	}
+
+	start := &step{stop: origin, time: depart}
+	l.improve(start)
+	p.walk(l, start, until)
+
+	// boarded contains the journey to the boarding stop of each trip which
+	// has been boarded
+	type boarding struct {
+		prev  *step
+		board *Connection
+		stops int
+	}
+	boarded := make([]*boarding, p.tripCount)
+
+	first := sort.Search(len(p.connections), func(i int) bool {
+		return p.connections[i].Departure >= depart
+	})
+
+	for i := first; i < len(p.connections); i++ {
+		c := p.connections[i]
+		if c.Departure > until {
+			break
+		}
+		if best, ok := l.arrival[target]; ok && best.time <= c.Departure {
+			break
+		}
+
+		trip := boarded[p.trips[i]]
+		if trip == nil {
+			ready, ok := l.ready[c.From]
+			if !ok || ready.ready() > c.Departure {
+				continue
+			}
+			trip = &boarding{prev: ready, board: c}
+			boarded[p.trips[i]] = trip
+		}
+		trip.stops++
+
+		if c.Arrival > until {
+			continue
+		}
+
+		s := &step{
+			prev:   trip.prev,
+			stop:   c.To,
+			time:   c.Arrival,
+			board:  trip.board,
+			alight: c,
+			stops:  trip.stops,
+		}
+		l.improve(s)
+
+		if best, ok := l.ride[c.To]; !ok || s.time < best.time {
+			l.ride[c.To] = s
+			p.walk(l, s, until)
+		}
+	}
+
+	return l
+}
+
+// walk adds walks from the end of a step to all nearby stops
+func (p *Planner) walk(l *labels, from *step, until int) {
+	for _, path := range p.footpaths[from.stop] {
+		if from.time+path.duration > until {
+			continue
+		}
+
+		l.improve(&step{
+			prev:     from,
+			stop:     path.to,
+			time:     from.time + path.duration,
+			distance: path.distance,
+		})
+	}
+}
+
+// firstRide returns the first ride of the journey which ends with the
+// given step (nil if it's only walking)
+func firstRide(last *step) *step {
+	var ride *step
+	for s := last; s.prev != nil; s = s.prev {
+		if s.board != nil {
+			ride = s
+		}
+	}
+	return ride
+}
+
+// itinerary converts the journey which ends with the given step to an
+// itinerary
+func (p *Planner) itinerary(last *step) *Itinerary {
+	var steps []*step
+	for s := last; s.prev != nil; s = s.prev {
+		steps = append(steps, s)
+	}
+
+	legs := make([]*Leg, len(steps))
+	rides := 0
+	for i := range steps {
+		s := steps[len(steps)-1-i]
+
+		if s.board != nil {
+			rides++
+			line := s.board.Line
+			legs[i] = &Leg{
+				Line:      &line,
+				Direction: s.board.Direction,
+				From:      p.stop(s.board.From),
+				To:        p.stop(s.stop),
+				Departure: clock(s.board.Departure),
+				Arrival:   clock(s.time),
+				Stops:     s.stops,
+			}
+			continue
+		}
+
+		departure := s.prev.time
+		// leave just in time for the ride after the first walk instead
+		// of waiting at the stop
+		if i == 0 && i+1 < len(steps) && steps[len(steps)-2].board != nil {
+			departure = steps[len(steps)-2].board.Departure - (s.time - s.prev.time)
+		}
+
+		legs[i] = &Leg{
+			From:      p.stop(s.prev.stop),
+			To:        p.stop(s.stop),
+			Departure: clock(departure),
+			Arrival:   clock(departure + s.time - s.prev.time),
+			Distance:  s.distance,
+		}
+	}
+
+	itinerary := &Itinerary{Legs: legs}
+	if len(legs) == 0 {
+		itinerary.Departure = clock(last.time)
+		itinerary.Arrival = clock(last.time)
+		return itinerary
+	}
+
+	itinerary.Departure = legs[0].Departure
+	itinerary.Arrival = legs[len(legs)-1].Arrival
+	itinerary.Duration = minutes(itinerary.Arrival) - minutes(itinerary.Departure)
+	if rides > 1 {
+		itinerary.Transfers = rides - 1
+	}
+
+	return itinerary
+}
+
+// stop returns a copy of a stop, so that callers can modify it
+func (p *Planner) stop(stopID int) *common.Stop {
+	stop, ok := p.stops[stopID]
+	if !ok {
+		return &common.Stop{ID: stopID}
+	}
+
+	stopCopy := *stop
+	return &stopCopy
+}
+
+func clock(minutes int) *schedules.Time {
+	return schedules.NewTime(minutes/60, minutes%60)
+}
+
+func minutes(t *schedules.Time) int {
+	return t.Hours*60 + t.Minutes
+}
+
+const earthRadius = 6371000 // in metres
+
+// distance returns the great-circle distance between two stops in metres
+func distance(a *common.Stop, b *common.Stop) float64 {
+	radians := func(degrees float64) float64 {
+		return degrees * math.Pi / 180
+	}
+
+	latitudeA, latitudeB := radians(a.Latitude), radians(b.Latitude)
+	h := math.Pow(math.Sin((latitudeB-latitudeA)/2), 2) +
+		math.Cos(latitudeA)*math.Cos(latitudeB)*
+			math.Pow(math.Sin(radians(b.Longitude-a.Longitude)/2), 2)
+
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,183 @@
+package planner
+
+import (
+	"testing"
+
+	"github.com/DexterLB/skgt_api/common"
+)
+
+func testPlanner() *Planner {
+	stops := []*common.Stop{
+		{ID: 1, Latitude: 42.00, Longitude: 23.3},
+		{ID: 2, Latitude: 42.01, Longitude: 23.3},
+		{ID: 3, Latitude: 42.02, Longitude: 23.3},
+		// about 11 metres from 3
+		{ID: 4, Latitude: 42.0201, Longitude: 23.3},
+		{ID: 5, Latitude: 42.05, Longitude: 23.3},
+		{ID: 6, Latitude: 42.10, Longitude: 23.3},
+	}
+
+	bus1 := common.Line{Vehicle: common.Bus, Number: "1"}
+	tram2 := common.Line{Vehicle: common.Tram, Number: "2"}
+	tram3 := common.Line{Vehicle: common.Tram, Number: "3"}
+	bus5 := common.Line{Vehicle: common.Bus, Number: "5"}
+
+	connections := []*Connection{
+		{"early", bus1, "1 - 3", 1, 2, 8 * 60, 8*60 + 10},
+		{"early", bus1, "1 - 3", 2, 3, 8*60 + 10, 8*60 + 20},
+		{"late", bus1, "1 - 3", 1, 2, 8*60 + 30, 8*60 + 40},
+		{"late", bus1, "1 - 3", 2, 3, 8*60 + 40, 8*60 + 50},
+		// can't be caught after the early bus because there's no time to
+		// change vehicles
+		{"fast", tram3, "2 - 5", 2, 5, 8*60 + 10, 8*60 + 25},
+		{"slow", tram2, "2 - 5", 2, 5, 8*60 + 11, 8*60 + 30},
+		{"from3", bus5, "3 - 5", 3, 5, 8*60 + 30, 8*60 + 40},
+	}
+
+	return New(stops, connections)
+}
+
+func TestPlan_Transfer(t *testing.T) {
+	itineraries := testPlanner().Plan(1, 5, 7*60+55, 180, 1)
+	if len(itineraries) != 1 {
+		t.Fatalf("expected 1 itinerary, got %d", len(itineraries))
+	}
+
+	itinerary := itineraries[0]
+	if len(itinerary.Legs) != 2 || itinerary.Transfers != 1 {
+		t.Fatalf("expected 2 legs with a transfer: %+v", itinerary)
+	}
+
+	first, second := itinerary.Legs[0], itinerary.Legs[1]
+	if first.Line.Number != "1" || first.From.ID != 1 || first.To.ID != 2 || first.Stops != 1 {
+		t.Errorf("wrong first leg: %+v", first)
+	}
+	if second.Line.Number != "2" || second.From.ID != 2 || second.To.ID != 5 {
+		t.Errorf("wrong second leg: %+v", second)
+	}
+
+	if itinerary.Departure.Hours != 8 || itinerary.Departure.Minutes != 0 ||
+		itinerary.Arrival.Hours != 8 || itinerary.Arrival.Minutes != 30 ||
+		itinerary.Duration != 30 {
+		t.Errorf("wrong times: %v - %v (%d minutes)", itinerary.Departure, itinerary.Arrival, itinerary.Duration)
+	}
+}
+
+func TestPlan_WalkAfterRide(t *testing.T) {
+	itineraries := testPlanner().Plan(1, 4, 7*60+55, 180, 1)
+	if len(itineraries) != 1 {
+		t.Fatalf("expected 1 itinerary, got %d", len(itineraries))
+	}
+
+	legs := itineraries[0].Legs
+	if len(legs) != 2 || legs[0].Stops != 2 || legs[1].Line != nil || legs[1].To.ID != 4 {
+		t.Fatalf("expected a ride and a walk: %+v", legs)
+	}
+
+	if legs[1].Distance < 10 || legs[1].Distance > 12 {
+		t.Errorf("wrong walking distance: %f", legs[1].Distance)
+	}
+	if legs[1].Arrival.Hours != 8 || legs[1].Arrival.Minutes != 21 {
+		t.Errorf("wrong arrival: %v", legs[1].Arrival)
+	}
+}
+
+func TestPlan_WalkBeforeRide(t *testing.T) {
+	itineraries := testPlanner().Plan(4, 5, 8*60, 180, 1)
+	if len(itineraries) != 1 {
+		t.Fatalf("expected 1 itinerary, got %d", len(itineraries))
+	}
+
+	legs := itineraries[0].Legs
+	if len(legs) != 2 || legs[0].Line != nil || legs[1].Line.Number != "5" {
+		t.Fatalf("expected a walk and a ride: %+v", legs)
+	}
+
+	// the walk should end just before the bus leaves
+	if legs[0].Departure.Hours != 8 || legs[0].Departure.Minutes != 29 {
+		t.Errorf("wrong departure: %v", legs[0].Departure)
+	}
+	if itineraries[0].Transfers != 0 {
+		t.Errorf("walking to the first ride is not a transfer")
+	}
+}
+
+func TestPlan_LaterItineraries(t *testing.T) {
+	itineraries := testPlanner().Plan(1, 3, 7*60+55, 180, 3)
+	if len(itineraries) != 2 {
+		t.Fatalf("expected 2 itineraries, got %d", len(itineraries))
+	}
+
+	if itineraries[0].Departure.Minutes != 0 || itineraries[1].Departure.Minutes != 30 {
+		t.Errorf(
+			"wrong departures: %v and %v",
+			itineraries[0].Departure, itineraries[1].Departure,
+		)
+	}
+}
+
+func TestPlan_Unreachable(t *testing.T) {
+	p := testPlanner()
+
+	if itineraries := p.Plan(1, 6, 7*60+55, 180, 3); len(itineraries) != 0 {
+		t.Errorf("found itineraries to an unreachable stop: %+v", itineraries)
+	}
+
+	if itineraries := p.Plan(1, 5, 7*60+55, 10, 3); len(itineraries) != 0 {
+		t.Errorf("found itineraries longer than the limit: %+v", itineraries)
+	}
+}
+
+func TestPlan_StopsAreCopies(t *testing.T) {
+	p := testPlanner()
+
+	itineraries := p.Plan(1, 3, 7*60+55, 180, 1)
+	itineraries[0].Legs[0].From.Name = "changed"
+
+	if p.stops[1].Name != "" {
+		t.Errorf("changing an itinerary changed the planner's stops")
+	}
+}
+
+func TestFirstDeparture(t *testing.T) {
+	if first := testPlanner().FirstDeparture(); first != 8*60 {
+		t.Errorf("wrong first departure: %d", first)
+	}
+
+	if first := New(nil, nil).FirstDeparture(); first != 0 {
+		t.Errorf("wrong first departure without connections: %d", first)
+	}
+}
+
+func TestReachable(t *testing.T) {
+	reachable := testPlanner().Reachable(1, 7*60+55, 30)
+
+	expected := []struct {
+		stop      int
+		minutes   int
+		transfers int
+	}{
+		{1, 0, 0},
+		{2, 15, 0},
+		{3, 25, 0},
+		{4, 26, 0},
+	}
+
+	if len(reachable) != len(expected) {
+		t.Fatalf("expected %d reachable stops, got %d: %+v", len(expected), len(reachable), reachable)
+	}
+
+	for i := range expected {
+		if reachable[i].Stop.ID != expected[i].stop ||
+			reachable[i].Minutes != expected[i].minutes ||
+			reachable[i].Transfers != expected[i].transfers {
+			t.Errorf("wrong reachable stop %d: %+v", i, reachable[i])
+		}
+	}
+
+	reachable = testPlanner().Reachable(1, 7*60+55, 35)
+	last := reachable[len(reachable)-1]
+	if last.Stop.ID != 5 || last.Transfers != 1 || last.Arrival.Minutes != 30 {
+		t.Errorf("wrong arrival at the farthest stop: %+v", last)
+	}
+}
@@ -0,0 +1,279 @@
+package realtime
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// captchas may come in any of these formats
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/DexterLB/htmlparsing"
+)
+
+// CaptchaSolver reads a captcha image and returns the text in it
+type CaptchaSolver interface {
+	Solve(captcha io.Reader) (string, error)
+}
+
+// SimpleSolver solves captchas with htmlparsing.BreakSimpleCaptcha
+type SimpleSolver struct{}
+
+// Solve implements the CaptchaSolver interface
+func (s SimpleSolver) Solve(captcha io.Reader) (string, error) {
+	return htmlparsing.BreakSimpleCaptcha(captcha)
+}
+
+// NewCaptchaSolver returns the solver with the given name ("simple" or
+// "template"). The template solver learns its templates from templateDir.
+func NewCaptchaSolver(name string, templateDir string) (CaptchaSolver, error) {
+	switch name {
+	case "", "simple":
+		return SimpleSolver{}, nil
+	case "template":
+		return LearnTemplates(templateDir)
+	default:
+		return nil, fmt.Errorf("unknown captcha solver [%s]", name)
+	}
+}
+
+const (
+	glyphWidth  = 12
+	glyphHeight = 16
+
+	// a character has at least 1/minGlyphFraction of the captcha's
+	// height in dark pixels
+	minGlyphFraction = 4
+)
+
+// glyph is a single character scaled to glyphWidth x glyphHeight, with the
+// darkness of each pixel between 0 and 1
+type glyph [glyphWidth * glyphHeight]float64
+
+// TemplateSolver solves captchas by splitting them into characters and
+// comparing each one to templates learned from labelled captchas
+type TemplateSolver struct {
+	templates map[rune]*glyph
+}
+
+// LearnTemplates creates a TemplateSolver from a directory of captcha
+// images, each named after the text in it (e.g. "4821.png"). Anything after
+// an underscore is ignored, so there may be several images with the same
+// text ("4821_2.png").
+func LearnTemplates(dir string) (*TemplateSolver, error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make(map[rune]*glyph)
+	counts := make(map[rune]int)
+
+	for _, filename := range filenames {
+		label := CaptchaLabel(filename)
+
+		glyphs, err := readGlyphs(filename)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read captcha %s: %s", filename, err)
+		}
+
+		characters := []rune(label)
+		if len(glyphs) != len(characters) {
+			// the characters couldn't be separated, so we can't tell
+			// which glyph is which
+			continue
+		}
+
+		for i, character := range characters {
+			if sums[character] == nil {
+				sums[character] = &glyph{}
+			}
+			for j := range glyphs[i] {
+				sums[character][j] += glyphs[i][j]
+			}
+			counts[character]++
+		}
+	}
+
+	if len(sums) == 0 {
+		return nil, fmt.Errorf("no usable captchas in %s", dir)
+	}
+
+	solver := &TemplateSolver{templates: make(map[rune]*glyph)}
+	for character, sum := range sums {
+		template := &glyph{}
+		for j := range sum {
+			template[j] = sum[j] / float64(counts[character])
+		}
+		solver.templates[character] = template
+	}
+
+	return solver, nil
+}
+
+// CaptchaLabel returns the text of a labelled captcha image file
+func CaptchaLabel(filename string) string {
+	label := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	return strings.SplitN(label, "_", 2)[0]
+}
+
+// Solve implements the CaptchaSolver interface
+func (s *TemplateSolver) Solve(captcha io.Reader) (string, error) {
+	img, _, err := image.Decode(captcha)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode captcha: %s", err)
+	}
+
+	glyphs := splitGlyphs(img)
+	if len(glyphs) == 0 {
+		return "", fmt.Errorf("no characters found in captcha")
+	}
+
+	result := make([]rune, len(glyphs))
+	for i := range glyphs {
+		result[i] = s.match(glyphs[i])
+	}
+
+	return string(result), nil
+}
+
+// match returns the character whose template is closest to the glyph
+func (s *TemplateSolver) match(g *glyph) rune {
+	var best rune
+	bestDistance := math.Inf(1)
+
+	for character, template := range s.templates {
+		distance := 0.0
+		for i := range g {
+			difference := g[i] - template[i]
+			distance += difference * difference
+		}
+
+		if distance < bestDistance || (distance == bestDistance && character < best) {
+			best = character
+			bestDistance = distance
+		}
+	}
+
+	return best
+}
+
+func readGlyphs(filename string) ([]*glyph, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return splitGlyphs(img), nil
+}
+
+// splitGlyphs finds the characters in a captcha. Characters are separated
+// by columns without any dark pixels.
+func splitGlyphs(img image.Image) []*glyph {
+	dark := darkPixels(img)
+	bounds := img.Bounds()
+
+	var glyphs []*glyph
+	start := -1
+	pixels := 0
+	for x := 0; x <= bounds.Dx(); x++ {
+		column := 0
+		if x < bounds.Dx() {
+			for y := 0; y < bounds.Dy(); y++ {
+				if dark[y][x] {
+					column++
+				}
+			}
+		}
+
+		switch {
+		case column > 0 && start < 0:
+			start = x
+			pixels = column
+		case column > 0:
+			pixels += column
+		case start >= 0:
+			// specks are noise rather than characters, but a character
+			// may be a single column wide (e.g. a thin "1")
+			if pixels >= bounds.Dy()/minGlyphFraction {
+				glyphs = append(glyphs, cutGlyph(dark, start, x))
+			}
+			start = -1
+		}
+	}
+
+	return glyphs
+}
+
+// darkPixels marks the pixels darker than the middle between the darkest
+// and the lightest one
+func darkPixels(img image.Image) [][]bool {
+	bounds := img.Bounds()
+
+	lightness := make([][]float64, bounds.Dy())
+	darkest, lightest := math.Inf(1), math.Inf(-1)
+	for y := range lightness {
+		lightness[y] = make([]float64, bounds.Dx())
+		for x := range lightness[y] {
+			gray := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray)
+			lightness[y][x] = float64(gray.Y)
+			darkest = math.Min(darkest, lightness[y][x])
+			lightest = math.Max(lightest, lightness[y][x])
+		}
+	}
+
+	threshold := (darkest + lightest) / 2
+
+	dark := make([][]bool, bounds.Dy())
+	for y := range dark {
+		dark[y] = make([]bool, bounds.Dx())
+		for x := range dark[y] {
+			dark[y][x] = lightness[y][x] < threshold
+		}
+	}
+
+	return dark
+}
+
+// cutGlyph crops the columns [left, right) to the rows containing dark
+// pixels and scales the result to the size of a glyph
+func cutGlyph(dark [][]bool, left int, right int) *glyph {
+	top, bottom := len(dark), 0
+	for y := range dark {
+		for x := left; x < right; x++ {
+			if dark[y][x] {
+				if y < top {
+					top = y
+				}
+				bottom = y + 1
+				break
+			}
+		}
+	}
+
+	g := &glyph{}
+	for y := 0; y < glyphHeight; y++ {
+		for x := 0; x < glyphWidth; x++ {
+			sourceY := top + y*(bottom-top)/glyphHeight
+			sourceX := left + x*(right-left)/glyphWidth
+			if dark[sourceY][sourceX] {
+				g[y*glyphWidth+x] = 1
+			}
+		}
+	}
+
+	return g
+}
@@ -0,0 +1,126 @@
+package realtime
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// captchaDir returns a directory of labelled captchas from the virtual
+// board, skipping the test if there are none
+func captchaDir(t *testing.T, name string) string {
+	dir := filepath.Join("testdata", "captcha", name)
+	filenames, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filenames) == 0 {
+		t.Skipf("no captchas in %s, save some from the virtual board named after their text", dir)
+	}
+	return dir
+}
+
+// solverAccuracy runs the solver on all labelled captchas in a directory,
+// returning the fraction of them which were solved correctly
+func solverAccuracy(t *testing.T, solver CaptchaSolver, dir string) float64 {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	correct := 0
+	for _, filename := range filenames {
+		f, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := solver.Solve(f)
+		f.Close()
+
+		switch {
+		case err != nil:
+			t.Logf("unable to solve %s: %s", filename, err)
+		case result != CaptchaLabel(filename):
+			t.Logf("%s solved as %s", filename, result)
+		default:
+			correct++
+		}
+	}
+
+	return float64(correct) / float64(len(filenames))
+}
+
+func TestTemplateSolver(t *testing.T) {
+	solver, err := LearnTemplates(captchaDir(t, "train"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accuracy := solverAccuracy(t, solver, captchaDir(t, "test"))
+	t.Logf("template solver accuracy: %.0f%%", accuracy*100)
+
+	if accuracy < 0.9 {
+		t.Errorf("template solver accuracy is too low: %.0f%%", accuracy*100)
+	}
+}
+
+func TestSimpleSolver(t *testing.T) {
+	// the virtual board captchas are not in the style SimpleSolver is made
+	// for, so its accuracy is only reported
+	accuracy := solverAccuracy(t, SimpleSolver{}, captchaDir(t, "test"))
+	t.Logf("simple solver accuracy: %.0f%%", accuracy*100)
+}
+
+func TestSplitGlyphs(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 20, 16))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+
+	// a thin "1", a speck of noise and a wide block
+	for y := 2; y < 14; y++ {
+		img.SetGray(3, y, color.Gray{0})
+	}
+	img.SetGray(7, 8, color.Gray{0})
+	for y := 2; y < 14; y++ {
+		for x := 10; x < 16; x++ {
+			img.SetGray(x, y, color.Gray{0})
+		}
+	}
+
+	glyphs := splitGlyphs(img)
+	if len(glyphs) != 2 {
+		t.Fatalf("expected 2 glyphs, got %d", len(glyphs))
+	}
+
+	for i, g := range glyphs {
+		for j := range g {
+			if g[j] != 1 {
+				t.Errorf("glyph %d is not solid", i)
+				break
+			}
+		}
+	}
+}
+
+func TestNewCaptchaSolver(t *testing.T) {
+	solver, err := NewCaptchaSolver("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := solver.(SimpleSolver); !ok {
+		t.Errorf("default solver is %T instead of SimpleSolver", solver)
+	}
+
+	_, err = NewCaptchaSolver("template", filepath.Join("testdata", "nonexistent"))
+	if err == nil {
+		t.Errorf("no error for a template solver without templates")
+	}
+
+	_, err = NewCaptchaSolver("foo", "")
+	if err == nil {
+		t.Errorf("no error for an unknown solver")
+	}
+}
@@ -10,14 +10,16 @@ import (
 )
 
 // Arrivals returns all arrivals on the given line, at the given stop in the next
-// hour or so
-func Arrivals(settings *htmlparsing.Settings, stopID int, line *common.Line) ([]*Arrival, error) {
+// hour or so. Captchas are solved with the given solver (SimpleSolver if nil).
+func Arrivals(
+	settings *htmlparsing.Settings, solver CaptchaSolver, stopID int, line *common.Line,
+) ([]*Arrival, error) {
 	data, err := LookupStop(settings, stopID)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get stop data: %s", err)
 	}
 
-	err = data.BreakCaptcha()
+	err = data.BreakCaptcha(solver)
 	if err != nil {
 		return nil, err
 	}
@@ -36,8 +38,11 @@ type LineArrivals struct {
 	Arrivals []*Arrival
 }
 
-// AllArrivals returns all arrivals at a given stop in the next hour or so
-func AllArrivals(settings *htmlparsing.Settings, stopID int) ([]*LineArrivals, error) {
+// AllArrivals returns all arrivals at a given stop in the next hour or so.
+// Captchas are solved with the given solver (SimpleSolver if nil).
+func AllArrivals(
+	settings *htmlparsing.Settings, solver CaptchaSolver, stopID int,
+) ([]*LineArrivals, error) {
 	data, err := LookupStop(settings, stopID)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get stop data: %s", err)
@@ -47,7 +52,7 @@ func AllArrivals(settings *htmlparsing.Settings, stopID int) ([]*LineArrivals, e
 
 	i := 0
 	for line, lineID := range data.Lines {
-		err = data.BreakCaptcha()
+		err = data.BreakCaptcha(solver)
 		if err != nil {
 			return nil, err
 		}
@@ -1,31 +1,21 @@
 package realtime
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"os"
+	"sort"
 	"testing"
 
 	"github.com/DexterLB/htmlparsing"
 	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/replay"
 )
 
-func prettyPrint(t *testing.T, data interface{}, w io.Writer) {
-	s, err := json.MarshalIndent(data, "", "    ")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	_, err = fmt.Fprintf(w, "%s\n", string(s))
-	if err != nil {
-		t.Fatal(err)
-	}
-}
-
 func TestArrivals(t *testing.T) {
+	defer replay.Fixtures(t, randomFields...)()
+
 	arrivals, err := Arrivals(
 		htmlparsing.SensibleSettings(),
+		nil,
 		2045,
 		&common.Line{
 			Vehicle: common.Tram,
@@ -37,12 +27,15 @@ func TestArrivals(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	prettyPrint(t, arrivals, os.Stdout)
+	replay.Golden(t, arrivals)
 }
 
 func TestAllArrivals(t *testing.T) {
+	defer replay.Fixtures(t, randomFields...)()
+
 	arrivals, err := AllArrivals(
 		htmlparsing.SensibleSettings(),
+		nil,
 		1700,
 	)
 
@@ -50,5 +43,9 @@ func TestAllArrivals(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	prettyPrint(t, arrivals, os.Stdout)
+	sort.Slice(arrivals, func(i, j int) bool {
+		return fmt.Sprint(*arrivals[i].Line) < fmt.Sprint(*arrivals[j].Line)
+	})
+
+	replay.Golden(t, arrivals)
 }
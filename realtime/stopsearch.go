@@ -36,6 +36,11 @@ type Arrival struct {
 	Calculated      time.Time // when Time was estimated
 	AirConditioning bool
 	Accessibility   bool
+	// ScheduledTime is when the arrival is scheduled and DelayMinutes is
+	// how late it is. Both are only set if the arrival has been matched to
+	// the schedule.
+	ScheduledTime *time.Time `json:",omitempty"`
+	DelayMinutes  *int       `json:",omitempty"`
 }
 
 // Arrivals gets all arrivals for a given line at the stop
@@ -80,14 +85,19 @@ func (s *StopData) LoadCaptcha() error {
 }
 
 // BreakCaptcha populates the CaptchaResult field with a captcha obtained
-// by analysis of the Captcha field
-func (s *StopData) BreakCaptcha() error {
+// by analysis of the Captcha field with the given solver (SimpleSolver
+// if nil)
+func (s *StopData) BreakCaptcha(solver CaptchaSolver) error {
+	if solver == nil {
+		solver = SimpleSolver{}
+	}
+
 	err := s.LoadCaptcha()
 	if err != nil {
 		return fmt.Errorf("unable to load captcha: %s", err)
 	}
 
-	result, err := htmlparsing.BreakSimpleCaptcha(s.Captcha)
+	result, err := solver.Solve(s.Captcha)
 	if err != nil {
 		return fmt.Errorf("unable to break captcha: %s", err)
 	}
@@ -1,14 +1,63 @@
 package realtime
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/DexterLB/htmlparsing"
+	"github.com/DexterLB/skgt_api/replay"
 )
 
+// randomFields are form fields whose values differ between requests
+var randomFields = []string{
+	"ctl00$ContentPlaceHolder1$btnSearchLine.x",
+	"ctl00$ContentPlaceHolder1$btnSearchLine.y",
+	"ctl00$ContentPlaceHolder1$CaptchaInput",
+}
+
 func TestLookupStop(t *testing.T) {
-	_, err := LookupStop(htmlparsing.SensibleSettings(), 1700)
+	defer replay.Fixtures(t, randomFields...)()
+
+	data, err := LookupStop(htmlparsing.SensibleSettings(), 1700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(map[string]int)
+	for line, id := range data.Lines {
+		lines[fmt.Sprintf("%s %s", line.Vehicle, line.Number)] = id
+	}
+
+	replay.Golden(t, struct {
+		Name        string
+		Description string
+		Lines       map[string]int
+	}{
+		data.Name,
+		data.Description,
+		lines,
+	})
+}
+
+func TestStopData_Arrivals(t *testing.T) {
+	defer replay.Fixtures(t, randomFields...)()
+
+	data, err := LookupStop(htmlparsing.SensibleSettings(), 1700)
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	var arrivals [][]*Arrival
+	for i, lineID := range []int{11, 22} {
+		// captcha answers are ignored when replaying
+		data.CaptchaResult = fmt.Sprintf("%d", 1234+i*4444)
+
+		lineArrivals, err := data.Arrivals(lineID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		arrivals = append(arrivals, lineArrivals)
+	}
+
+	replay.Golden(t, arrivals)
 }
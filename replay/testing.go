@@ -0,0 +1,71 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	record = flag.Bool("record", false, "record fixtures from the live upstream servers")
+	update = flag.Bool("update", false, "overwrite golden files with the actual results")
+)
+
+// Fixtures installs a transport which replays the fixtures of the current
+// test (from testdata/fixtures/<test name>), or records them when the
+// tests are run with -record. The test is skipped if there are no fixtures.
+// The returned function uninstalls the transport. Like Install, it must not
+// be used in parallel tests.
+func Fixtures(t testing.TB, ignoreFields ...string) func() {
+	dir := filepath.Join("testdata", "fixtures", t.Name())
+
+	mode := Replay
+	if *record {
+		mode = Record
+		err := os.RemoveAll(dir)
+		if err != nil {
+			t.Fatalf("unable to remove old fixtures: %s", err)
+		}
+	} else if _, err := os.Stat(dir); os.IsNotExist(err) {
+		t.Skipf("no fixtures in %s, run with -record to record them", dir)
+	}
+
+	return New(dir, mode, ignoreFields...).Install()
+}
+
+// Golden compares the JSON representation of actual with the golden file
+// testdata/golden/<test name>.json, or overwrites the file when the tests
+// are run with -update
+func Golden(t testing.TB, actual interface{}) {
+	filename := filepath.Join("testdata", "golden", t.Name()+".json")
+
+	data, err := json.MarshalIndent(actual, "", "    ")
+	if err != nil {
+		t.Fatalf("unable to marshal result: %s", err)
+	}
+	data = append(data, '\n')
+
+	if *update {
+		err = os.MkdirAll(filepath.Dir(filename), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(filename, data, 0644)
+		}
+		if err != nil {
+			t.Fatalf("unable to write golden file: %s", err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unable to read golden file (run with -update to create it): %s", err)
+	}
+
+	if !bytes.Equal(expected, data) {
+		t.Errorf("result differs from %s:\n%s", filename, string(data))
+	}
+}
@@ -0,0 +1,283 @@
+// Package replay provides an HTTP transport which records exchanges with
+// upstream servers into fixture files and replays them later, so that the
+// parsers can be tested offline and deterministically.
+//
+// htmlparsing clients send their requests through http.DefaultTransport,
+// so Install is the way to plug a transport into them. Since that replaces
+// the transport of the whole process, tests which use it must not call
+// t.Parallel.
+//
+// TODO: pass the transport through htmlparsing.Settings once it accepts an
+// http.RoundTripper, and drop Install. The fixtures and golden files are
+// recorded with `go test -record -update` against the live servers.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mode selects whether a transport talks to upstream servers
+type Mode int
+
+const (
+	// Replay serves responses from the fixture files only
+	Replay Mode = iota
+	// Record forwards requests upstream and saves the exchanges
+	Record
+)
+
+// Transport is a http.RoundTripper which records or replays exchanges.
+// Each exchange is stored in its own file in Dir (001.http, 002.http etc),
+// containing the request followed by the response.
+type Transport struct {
+	Dir  string
+	Mode Mode
+
+	// Upstream is used for recording (http.DefaultTransport if nil)
+	Upstream http.RoundTripper
+
+	// IgnoreFields are form fields whose values may differ between the
+	// recorded and the replayed requests (e.g. random or captcha values)
+	IgnoreFields []string
+
+	mutex     sync.Mutex
+	exchanges []*exchange
+	loaded    bool
+	recorded  int
+}
+
+type exchange struct {
+	request  *http.Request
+	body     []byte
+	response []byte
+	used     bool
+}
+
+// New returns a transport for the given fixture directory
+func New(dir string, mode Mode, ignoreFields ...string) *Transport {
+	return &Transport{
+		Dir:          dir,
+		Mode:         mode,
+		IgnoreFields: ignoreFields,
+	}
+}
+
+// Install makes the transport the default one, returning a function which
+// restores the previous default transport. It affects every HTTP client in
+// the process which uses the default transport, so it must not be called
+// from parallel tests.
+func (t *Transport) Install() func() {
+	old := http.DefaultTransport
+	if t.Upstream == nil {
+		t.Upstream = old
+	}
+	http.DefaultTransport = t
+
+	return func() {
+		http.DefaultTransport = old
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *Transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	body, err := readBody(request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read request body: %s", err)
+	}
+
+	if t.Mode == Record {
+		return t.record(request, body)
+	}
+	return t.replay(request, body)
+}
+
+func (t *Transport) record(request *http.Request, body []byte) (*http.Response, error) {
+	upstream := t.Upstream
+	if upstream == nil {
+		upstream = http.DefaultTransport
+	}
+
+	response, err := upstream.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response body: %s", err)
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+	response.ContentLength = int64(len(responseBody))
+	response.TransferEncoding = nil
+
+	data := &bytes.Buffer{}
+
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	err = request.WriteProxy(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to dump request: %s", err)
+	}
+
+	err = response.Write(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to dump response: %s", err)
+	}
+
+	t.mutex.Lock()
+	t.recorded++
+	filename := filepath.Join(t.Dir, fmt.Sprintf("%03d.http", t.recorded))
+	t.mutex.Unlock()
+
+	err = os.MkdirAll(t.Dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create fixture directory: %s", err)
+	}
+
+	err = ioutil.WriteFile(filename, data.Bytes(), 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write fixture: %s", err)
+	}
+
+	response.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+	return response, nil
+}
+
+// replay finds the first unused recorded exchange matching the request.
+// If all matching exchanges have been used, the last of them is reused.
+func (t *Transport) replay(request *http.Request, body []byte) (*http.Response, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.loaded {
+		err := t.load()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load fixtures: %s", err)
+		}
+		t.loaded = true
+	}
+
+	var found *exchange
+	for _, exchange := range t.exchanges {
+		if !t.matches(exchange, request, body) {
+			continue
+		}
+
+		found = exchange
+		if !exchange.used {
+			break
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf(
+			"no fixture in %s for %s %s", t.Dir, request.Method, request.URL,
+		)
+	}
+	found.used = true
+
+	return http.ReadResponse(
+		bufio.NewReader(bytes.NewReader(found.response)),
+		request,
+	)
+}
+
+func (t *Transport) matches(exchange *exchange, request *http.Request, body []byte) bool {
+	if exchange.request.Method != request.Method ||
+		exchange.request.URL.String() != request.URL.String() {
+		return false
+	}
+
+	if !isForm(request) {
+		return bytes.Equal(exchange.body, body)
+	}
+
+	return t.canonicalForm(exchange.body) == t.canonicalForm(body)
+}
+
+// canonicalForm encodes the form without the ignored fields, sorted by key
+func (t *Transport) canonicalForm(body []byte) string {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return string(body)
+	}
+
+	for _, field := range t.IgnoreFields {
+		values.Del(field)
+	}
+
+	return values.Encode()
+}
+
+// load reads all exchanges from the fixture directory
+func (t *Transport) load() error {
+	filenames, err := filepath.Glob(filepath.Join(t.Dir, "*.http"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		reader := bufio.NewReader(bytes.NewReader(data))
+		request, err := http.ReadRequest(reader)
+		if err != nil {
+			return fmt.Errorf("unable to parse request in %s: %s", filename, err)
+		}
+
+		body, err := readBody(request)
+		if err != nil {
+			return fmt.Errorf("unable to read request body in %s: %s", filename, err)
+		}
+
+		response, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+
+		t.exchanges = append(t.exchanges, &exchange{
+			request:  request,
+			body:     body,
+			response: response,
+		})
+	}
+
+	return nil
+}
+
+// readBody reads the body of a request, leaving it readable again
+func readBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	request.Body.Close()
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
+
+func isForm(request *http.Request) bool {
+	return strings.HasPrefix(
+		request.Header.Get("Content-Type"),
+		"application/x-www-form-urlencoded",
+	)
+}
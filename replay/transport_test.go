@@ -0,0 +1,94 @@
+package replay
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func get(t *testing.T, client *http.Client, url string) string {
+	response, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func post(t *testing.T, client *http.Client, url string, values url.Values) string {
+	response, err := client.PostForm(url, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		r.ParseForm()
+		fmt.Fprintf(w, "%d %s %s", requests, r.URL.Path, r.Form.Get("line"))
+	}))
+
+	recorder := New(dir, Record)
+	client := &http.Client{Transport: recorder}
+
+	expected := []string{
+		get(t, client, server.URL+"/foo"),
+		get(t, client, server.URL+"/foo"),
+		post(t, client, server.URL+"/bar", url.Values{"line": {"10"}, "captcha": {"1234"}}),
+		post(t, client, server.URL+"/bar", url.Values{"line": {"94"}, "captcha": {"5678"}}),
+	}
+	server.Close()
+
+	if expected[0] != "1 /foo " || expected[3] != "4 /bar 94" {
+		t.Fatalf("unexpected responses while recording: %v", expected)
+	}
+
+	client = &http.Client{Transport: New(dir, Replay, "captcha")}
+
+	actual := []string{
+		get(t, client, server.URL+"/foo"),
+		get(t, client, server.URL+"/foo"),
+		post(t, client, server.URL+"/bar", url.Values{"line": {"94"}, "captcha": {"0000"}}),
+		post(t, client, server.URL+"/bar", url.Values{"line": {"10"}, "captcha": {"0000"}}),
+	}
+
+	for i, j := range []int{0, 1, 3, 2} {
+		if actual[i] != expected[j] {
+			t.Errorf("replayed response %d is %s instead of %s", i, actual[i], expected[j])
+		}
+	}
+
+	// all exchanges for /foo are used, so the last one is reused
+	if response := get(t, client, server.URL+"/foo"); response != expected[1] {
+		t.Errorf("reused response is %s instead of %s", response, expected[1])
+	}
+
+	_, err = client.Get(server.URL + "/baz")
+	if err == nil {
+		t.Errorf("no error for a request without a fixture")
+	}
+}
@@ -0,0 +1,20 @@
+package schedules
+
+import "github.com/DexterLB/skgt_api/common"
+
+// Arrival is a single scheduled arrival of a vehicle at a stop
+type Arrival struct {
+	Time    *Time
+	DayType ScheduleType
+	// Course is the index of the course (starting from 1) among all courses
+	// of the route for that day type
+	Course int
+}
+
+// LineArrivals pairs a line and one of its directions with the scheduled
+// arrivals at a single stop
+type LineArrivals struct {
+	Line      *common.Line
+	Direction string
+	Arrivals  []*Arrival
+}
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/DexterLB/htmlparsing"
 	"github.com/DexterLB/skgt_api/common"
@@ -70,15 +71,15 @@ const (
 	// None is an unknown day type
 	None ScheduleType = 0
 	// Workday is usualy monday-friday
-	Workday = 1
+	Workday ScheduleType = 1
 	// Holiday is any national holiday + all sundays
-	Holiday = 2
+	Holiday ScheduleType = 2
 	// PreHoliday are all days scheduled as free around national holidays + all saturdays
-	PreHoliday = 4
+	PreHoliday ScheduleType = 4
 	// HolidayAndPreHoliday is a combination of Holiday and Preholiday
-	HolidayAndPreHoliday = 6
+	HolidayAndPreHoliday ScheduleType = 6
 	// All is a combination of all day types
-	All = 7
+	All ScheduleType = 7
 )
 
 // Route is a route which can be performed by a vehicle. Most vehicles have
@@ -234,6 +235,56 @@ func parseType(typeName string) (ScheduleType, error) {
 	}
 }
 
+// ParseScheduleType parses a day type as given in API requests
+// (e.g. "workday", "holiday")
+func ParseScheduleType(input string) (ScheduleType, error) {
+	switch strings.ToLower(input) {
+	case "workday":
+		return Workday, nil
+	case "holiday":
+		return Holiday, nil
+	case "preholiday":
+		return PreHoliday, nil
+	case "holidayandpreholiday":
+		return HolidayAndPreHoliday, nil
+	case "all":
+		return All, nil
+	default:
+		return None, fmt.Errorf("unknown day type [%s]", input)
+	}
+}
+
+var clockRegexp = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+
+// ParseClock parses a time of day in the form "15:04" (up to "24:00")
+func ParseClock(input string) (*Time, error) {
+	groups := clockRegexp.FindStringSubmatch(input)
+	if len(groups) < 3 {
+		return nil, fmt.Errorf("unable to parse time [%s]", input)
+	}
+
+	hours, _ := strconv.Atoi(groups[1])
+	minutes, _ := strconv.Atoi(groups[2])
+	if hours > 24 || minutes > 59 || (hours == 24 && minutes > 0) {
+		return nil, fmt.Errorf("time out of range [%s]", input)
+	}
+
+	return NewTime(hours, minutes), nil
+}
+
+// DayTypeOf returns the day type of the given date, taking only weekends
+// into account (the calendar package also knows about holidays)
+func DayTypeOf(date time.Time) ScheduleType {
+	switch date.Weekday() {
+	case time.Saturday:
+		return PreHoliday
+	case time.Sunday:
+		return Holiday
+	default:
+		return Workday
+	}
+}
+
 // parseSchedule parses a single schedule, sending all stops it finds
 // down the stopNames channel
 func parseSchedule(scheduleDiv xml.Node, stopNames chan<- *StopName) (*routeData, error) {
@@ -339,6 +390,8 @@ func parseCourses(scheduleDiv xml.Node) ([]Course, error) {
 	return courses, nil
 }
 
+var courseRegexp = regexp.MustCompile(`.+\[\'\w+\', \'([0-9, ]+)\'\].*`)
+
 func parseCourse(jsCall string) (Course, error) {
 	// we shall now parse javascript code.
 	// here be dragons.
@@ -347,9 +400,7 @@ func parseCourse(jsCall string) (Course, error) {
 	// Raz.exec ('show_course', ['9caca5ad9', '4,761,763,765,766,767,768,770,772,775,777,780,783,785,788,792,794,796,798,800,802,804,806,807']); return false;
 
 	// we need the '4,761,...' part.
-	groups := regexp.MustCompile(
-		`.+\[\'\w+\', \'([0-9, ]+)\'\].*`,
-	).FindStringSubmatch(jsCall)
+	groups := courseRegexp.FindStringSubmatch(jsCall)
 	if len(groups) < 2 {
 		return nil, fmt.Errorf("unable to find time list in this javascript code: %s", jsCall)
 	}
@@ -1,57 +1,51 @@
 package schedules
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"os"
+	"sort"
 	"testing"
 
 	"github.com/DexterLB/htmlparsing"
 	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/replay"
 )
 
-func prettyPrint(t *testing.T, data interface{}, w io.Writer) {
-	s, err := json.MarshalIndent(data, "", "    ")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	_, err = fmt.Fprintf(w, "%s\n", string(s))
-	if err != nil {
-		t.Fatal(err)
-	}
+// sortTimetable sorts the routes of a timetable, which are returned
+// in random order
+func sortTimetable(timetable *Timetable) {
+	sort.Slice(timetable.Routes, func(i, j int) bool {
+		return timetable.Routes[i].Direction < timetable.Routes[j].Direction
+	})
 }
 
-func TestGetTimetable(t *testing.T) {
+func testTimetable(t *testing.T, line *common.Line) {
+	defer replay.Fixtures(t)()
+
 	stops := make(map[int]string)
 	stopNames := make(chan *StopName)
 
 	var timetable *Timetable
-	go func(timetable **Timetable) {
-		var err error
-
-		*timetable, err = GetTimetable(
+	var err error
+	go func() {
+		timetable, err = GetTimetable(
 			htmlparsing.SensibleSettings(),
-			&common.Line{
-				Vehicle: common.Tram,
-				Number:  "10",
-			},
+			line,
 			stopNames,
 		)
 
-		if err != nil {
-			t.Fatal(err)
-		}
-
 		close(stopNames)
-	}(&timetable)
+	}()
 
 	for stop := range stopNames {
 		stops[stop.ID] = stop.Name
 	}
 
-	prettyPrint(
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sortTimetable(timetable)
+
+	replay.Golden(
 		t,
 		struct {
 			Timetable *Timetable
@@ -60,69 +54,55 @@ func TestGetTimetable(t *testing.T) {
 			timetable,
 			stops,
 		},
-		os.Stdout,
 	)
 }
 
-func TestGetTimetable_Subway(t *testing.T) {
-	stops := make(map[int]string)
-	stopNames := make(chan *StopName)
-
-	var timetable *Timetable
-	go func(timetable **Timetable) {
-		var err error
-
-		*timetable, err = GetTimetable(
-			htmlparsing.SensibleSettings(),
-			&common.Line{
-				Vehicle: common.Subway,
-				Number:  "1",
-			},
-			stopNames,
-		)
-
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		close(stopNames)
-	}(&timetable)
-
-	for stop := range stopNames {
-		stops[stop.ID] = stop.Name
-	}
+func TestGetTimetable(t *testing.T) {
+	testTimetable(t, &common.Line{
+		Vehicle: common.Tram,
+		Number:  "10",
+	})
+}
 
-	prettyPrint(
-		t,
-		struct {
-			Timetable *Timetable
-			Stops     map[int]string
-		}{
-			timetable,
-			stops,
-		},
-		os.Stdout,
-	)
+func TestGetTimetable_Subway(t *testing.T) {
+	testTimetable(t, &common.Line{
+		Vehicle: common.Subway,
+		Number:  "1",
+	})
 }
 
 func TestAllLines(t *testing.T) {
+	defer replay.Fixtures(t)()
+
 	lines, err := AllLines(htmlparsing.SensibleSettings())
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	prettyPrint(t, lines, os.Stdout)
+	replay.Golden(t, lines)
 }
 
 func TestAllTimetables(t *testing.T) {
+	defer replay.Fixtures(t)()
+
 	timetables, stops, err := AllTimetables(htmlparsing.SensibleSettings(), 8)
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	prettyPrint(
+	sort.Slice(timetables, func(i, j int) bool {
+		return timetables[i].Line.Vehicle < timetables[j].Line.Vehicle
+	})
+	for _, timetable := range timetables {
+		sortTimetable(timetable)
+	}
+	sort.Slice(stops, func(i, j int) bool {
+		return stops[i].ID < stops[j].ID
+	})
+
+	replay.Golden(
 		t,
 		struct {
 			Timetables []*Timetable
@@ -131,6 +111,27 @@ func TestAllTimetables(t *testing.T) {
 			timetables,
 			stops,
 		},
-		os.Stdout,
 	)
 }
+
+func TestParseClock(t *testing.T) {
+	for input, expected := range map[string]*Time{
+		"8:05":  NewTime(8, 5),
+		"23:59": NewTime(23, 59),
+		"24:00": NewTime(24, 0),
+	} {
+		actual, err := ParseClock(input)
+		if err != nil {
+			t.Errorf("unable to parse %s: %s", input, err)
+		} else if *actual != *expected {
+			t.Errorf("%s parsed as %v", input, actual)
+		}
+	}
+
+	for _, input := range []string{"", "8", "8:5", "25:00", "24:01", "24:59", "12:60", "foo"} {
+		_, err := ParseClock(input)
+		if err == nil {
+			t.Errorf("no error when parsing %s", input)
+		}
+	}
+}
@@ -9,11 +9,21 @@ import (
 
 var (
 	_ScheduleTypeNameToValue = map[string]ScheduleType{
-		"None": None,
+		"None":                 None,
+		"Workday":              Workday,
+		"Holiday":              Holiday,
+		"PreHoliday":           PreHoliday,
+		"HolidayAndPreHoliday": HolidayAndPreHoliday,
+		"All":                  All,
 	}
 
 	_ScheduleTypeValueToName = map[ScheduleType]string{
-		None: "None",
+		None:                 "None",
+		Workday:              "Workday",
+		Holiday:              "Holiday",
+		PreHoliday:           "PreHoliday",
+		HolidayAndPreHoliday: "HolidayAndPreHoliday",
+		All:                  "All",
 	}
 )
 
@@ -21,7 +31,12 @@ func init() {
 	var v ScheduleType
 	if _, ok := interface{}(v).(fmt.Stringer); ok {
 		_ScheduleTypeNameToValue = map[string]ScheduleType{
-			interface{}(None).(fmt.Stringer).String(): None,
+			interface{}(None).(fmt.Stringer).String():                 None,
+			interface{}(Workday).(fmt.Stringer).String():              Workday,
+			interface{}(Holiday).(fmt.Stringer).String():              Holiday,
+			interface{}(PreHoliday).(fmt.Stringer).String():           PreHoliday,
+			interface{}(HolidayAndPreHoliday).(fmt.Stringer).String(): HolidayAndPreHoliday,
+			interface{}(All).(fmt.Stringer).String():                  All,
 		}
 	}
 }
@@ -4,13 +4,28 @@ package schedules
 
 import "fmt"
 
-const _ScheduleType_name = "None"
+const (
+	_ScheduleType_name_0 = "NoneWorkdayHoliday"
+	_ScheduleType_name_1 = "PreHoliday"
+	_ScheduleType_name_2 = "HolidayAndPreHolidayAll"
+)
 
-var _ScheduleType_index = [...]uint8{0, 4}
+var (
+	_ScheduleType_index_0 = [...]uint8{0, 4, 11, 18}
+	_ScheduleType_index_1 = [...]uint8{0, 10}
+	_ScheduleType_index_2 = [...]uint8{0, 20, 23}
+)
 
 func (i ScheduleType) String() string {
-	if i < 0 || i >= ScheduleType(len(_ScheduleType_index)-1) {
+	switch {
+	case 0 <= i && i <= 2:
+		return _ScheduleType_name_0[_ScheduleType_index_0[i]:_ScheduleType_index_0[i+1]]
+	case i == 4:
+		return _ScheduleType_name_1
+	case 6 <= i && i <= 7:
+		i -= 6
+		return _ScheduleType_name_2[_ScheduleType_index_2[i]:_ScheduleType_index_2[i+1]]
+	default:
 		return fmt.Sprintf("ScheduleType(%d)", i)
 	}
-	return _ScheduleType_name[_ScheduleType_index[i]:_ScheduleType_index[i+1]]
 }
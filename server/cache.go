@@ -0,0 +1,80 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DexterLB/skgt_api/realtime"
+)
+
+// defaultRealtimeCacheTTL is used when no TTL is configured
+const defaultRealtimeCacheTTL = 30 * time.Second
+
+// arrivalsCache keeps the realtime arrivals for each stop for a while.
+// Concurrent requests for a stop which isn't cached share a single lookup.
+type arrivalsCache struct {
+	ttl   time.Duration
+	fetch func(stopID int) ([]*realtime.LineArrivals, error)
+
+	mutex   sync.Mutex
+	entries map[int]*cacheEntry
+}
+
+type cacheEntry struct {
+	done     chan struct{}
+	arrivals []*realtime.LineArrivals
+	err      error
+	fetched  time.Time
+}
+
+func newArrivalsCache(
+	ttl time.Duration,
+	fetch func(stopID int) ([]*realtime.LineArrivals, error),
+) *arrivalsCache {
+	return &arrivalsCache{
+		ttl:     ttl,
+		fetch:   fetch,
+		entries: make(map[int]*cacheEntry),
+	}
+}
+
+// get returns the arrivals for the given stop and the time they were
+// obtained at, fetching them if they're not cached or are too old
+func (c *arrivalsCache) get(stopID int) ([]*realtime.LineArrivals, time.Time, error) {
+	arrivals, fetched, _, err := c.lookup(stopID)
+	return arrivals, fetched, err
+}
+
+// lookup is the same as get, but also reports whether this call fetched
+// the arrivals (rather than using cached ones or ones fetched by another
+// call)
+func (c *arrivalsCache) lookup(stopID int) ([]*realtime.LineArrivals, time.Time, bool, error) {
+	c.mutex.Lock()
+	entry, ok := c.entries[stopID]
+	owner := !ok || c.expired(entry)
+	if owner {
+		entry = &cacheEntry{done: make(chan struct{})}
+		c.entries[stopID] = entry
+	}
+	c.mutex.Unlock()
+
+	if owner {
+		entry.arrivals, entry.err = c.fetch(stopID)
+		entry.fetched = time.Now()
+		close(entry.done)
+	}
+
+	<-entry.done
+	return entry.arrivals, entry.fetched, owner, entry.err
+}
+
+// expired checks if an entry must be fetched again. Entries which are
+// still being fetched are never expired, and failed ones always are.
+func (c *arrivalsCache) expired(entry *cacheEntry) bool {
+	select {
+	case <-entry.done:
+		return entry.err != nil || time.Since(entry.fetched) >= c.ttl
+	default:
+		return false
+	}
+}
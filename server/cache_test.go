@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/realtime"
+)
+
+func TestArrivalsCache(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+
+	cache := newArrivalsCache(time.Hour, func(stopID int) ([]*realtime.LineArrivals, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return []*realtime.LineArrivals{
+			&realtime.LineArrivals{
+				Line: &common.Line{Vehicle: common.Tram, Number: fmt.Sprintf("%d", stopID)},
+			},
+		}, nil
+	})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			arrivals, _, err := cache.get(1700)
+			if err != nil {
+				t.Error(err)
+			} else if arrivals[0].Line.Number != "1700" {
+				t.Errorf("wrong arrivals for stop 1700: %v", arrivals[0].Line)
+			}
+		}()
+	}
+
+	// let the requests pile up on the single lookup
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	_, _, err := cache.get(1700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fetches != 1 {
+		t.Errorf("arrivals fetched %d times instead of once", fetches)
+	}
+
+	_, _, err = cache.get(2045)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fetches != 2 {
+		t.Errorf("arrivals for another stop not fetched")
+	}
+}
+
+func TestArrivalsCache_Expiry(t *testing.T) {
+	fetches := 0
+	fail := true
+
+	cache := newArrivalsCache(20*time.Millisecond, func(stopID int) ([]*realtime.LineArrivals, error) {
+		fetches++
+		if fail {
+			return nil, fmt.Errorf("upstream is down")
+		}
+		return []*realtime.LineArrivals{}, nil
+	})
+
+	_, _, err := cache.get(1700)
+	if err == nil {
+		t.Fatalf("no error from failed lookup")
+	}
+
+	// errors are not cached
+	fail = false
+	_, fetched, err := cache.get(1700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, cachedFetched, err := cache.get(1700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cachedFetched != fetched || fetches != 2 {
+		t.Errorf("fresh arrivals were fetched again")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	_, _, err = cache.get(1700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 3 {
+		t.Errorf("expired arrivals were not fetched again")
+	}
+}
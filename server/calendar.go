@@ -0,0 +1,18 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/DexterLB/skgt_api/calendar"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (s *Server) calendarDay(r *http.Request, params httprouter.Params) (interface{}, error) {
+	date, err := time.ParseInLocation(calendar.DateFormat, params.ByName("date"), location)
+	if err != nil {
+		return nil, badRequest("could not parse date: %s", err)
+	}
+
+	return s.calendar.Day(date), nil
+}
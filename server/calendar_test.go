@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/DexterLB/skgt_api/calendar"
+	"github.com/DexterLB/skgt_api/schedules"
+)
+
+func TestQueryDayType(t *testing.T) {
+	s := &Server{calendar: calendar.New(nil)}
+
+	for query, expected := range map[string]schedules.ScheduleType{
+		"":                    schedules.All,
+		"day_type=preholiday": schedules.PreHoliday,
+		// Liberation Day was on a Sunday
+		"date=2024-03-04":         schedules.Holiday,
+		"date=2024-03-05":         schedules.Workday,
+		"date=2024-03-03":         schedules.Holiday,
+		"date=2024-05-06":         schedules.Holiday,
+		"date=2024-05-11":         schedules.PreHoliday,
+		"date=2024-05-11&lang=en": schedules.PreHoliday,
+	} {
+		values, _ := url.ParseQuery(query)
+		dayType, err := s.queryDayType(values, schedules.All)
+		if err != nil {
+			t.Errorf("%s: %s", query, err)
+		} else if dayType != expected {
+			t.Errorf("%s: got %s instead of %s", query, dayType, expected)
+		}
+	}
+
+	for _, query := range []string{
+		"day_type=weekday",
+		"date=2024-02-30",
+		"date=2024-05-11&day_type=workday",
+	} {
+		values, _ := url.ParseQuery(query)
+		_, err := s.queryDayType(values, schedules.All)
+		if err == nil || toAPIError(err).code != codeBadRequest {
+			t.Errorf("%s: expected a bad request, got %v", query, err)
+		}
+	}
+}
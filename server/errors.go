@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/DexterLB/skgt_api/backend"
+)
+
+// Error codes returned in error responses
+const (
+	codeBadRequest    = "bad_request"
+	codeForbidden     = "forbidden"
+	codeNotFound      = "not_found"
+	codeConflict      = "conflict"
+	codeRateLimited   = "rate_limited"
+	codeQuotaExceeded = "quota_exceeded"
+	codeUpstreamError = "upstream_error"
+	codeInternalError = "internal_error"
+)
+
+// apiError is an error which knows its HTTP status
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// errorResponse is the body of all error responses
+type errorResponse struct {
+	Code      string
+	Message   string
+	RequestID string
+}
+
+// badRequest is returned when the request can't be parsed or is invalid
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{http.StatusBadRequest, codeBadRequest, fmt.Sprintf(format, args...)}
+}
+
+// notFound is returned when the requested object doesn't exist
+func notFound(format string, args ...interface{}) error {
+	return &apiError{http.StatusNotFound, codeNotFound, fmt.Sprintf(format, args...)}
+}
+
+// upstreamError is returned when SKGT's servers can't be reached or
+// return nonsense
+func upstreamError(format string, args ...interface{}) error {
+	return &apiError{http.StatusBadGateway, codeUpstreamError, fmt.Sprintf(format, args...)}
+}
+
+// toAPIError determines the status of an error
+func toAPIError(err error) *apiError {
+	switch err {
+	case backend.ErrNoSuchLine, backend.ErrNoSuchStop:
+		return &apiError{http.StatusNotFound, codeNotFound, err.Error()}
+	case backend.ErrWrongAPIKey, backend.ErrExpiredAPIKey:
+		return &apiError{http.StatusForbidden, codeForbidden, err.Error()}
+	}
+
+	if apiErr, ok := err.(*apiError); ok {
+		return apiErr
+	}
+
+	return &apiError{http.StatusInternalServerError, codeInternalError, err.Error()}
+}
+
+// writeError writes an error response for the given error
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := toAPIError(err)
+
+	if apiErr.status == http.StatusInternalServerError {
+		log.Printf("request %s failed: %s", requestID(r), err)
+	}
+
+	data, err := json.MarshalIndent(&errorResponse{
+		Code:      apiErr.code,
+		Message:   apiErr.message,
+		RequestID: requestID(r),
+	}, "", "    ")
+	if err != nil {
+		http.Error(w, apiErr.message, apiErr.status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.status)
+	w.Write(data)
+}
+
+type contextKey int
+
+const requestIDKey contextKey = 0
+
+// withRequestID attaches a new random request ID to the request and sets it
+// as the X-Request-Id header of the response
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	idBytes := make([]byte, 8)
+	_, err := rand.Read(idBytes)
+	if err != nil {
+		log.Printf("unable to generate request ID: %s", err)
+	}
+	id := hex.EncodeToString(idBytes)
+
+	w.Header().Set("X-Request-Id", id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+}
+
+// requestID returns the ID of the request
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
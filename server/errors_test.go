@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DexterLB/skgt_api/backend"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestJSONHandler_Errors(t *testing.T) {
+	for _, testCase := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{badRequest("invalid foo"), http.StatusBadRequest, codeBadRequest},
+		{backend.ErrNoSuchStop, http.StatusNotFound, codeNotFound},
+		{backend.ErrNoSuchLine, http.StatusNotFound, codeNotFound},
+		{upstreamError("SKGT is down"), http.StatusBadGateway, codeUpstreamError},
+		{errors.New("database is on fire"), http.StatusInternalServerError, codeInternalError},
+	} {
+		handler := jsonHandler(func(r *http.Request, params httprouter.Params) (interface{}, error) {
+			return nil, testCase.err
+		})
+
+		w := httptest.NewRecorder()
+		r := withRequestID(w, httptest.NewRequest("GET", "/foo", nil))
+		handler(w, r, nil)
+
+		if w.Code != testCase.status {
+			t.Errorf("status for [%s] is %d instead of %d", testCase.err, w.Code, testCase.status)
+		}
+
+		response := &errorResponse{}
+		err := json.Unmarshal(w.Body.Bytes(), response)
+		if err != nil {
+			t.Errorf("response for [%s] is not a single JSON object: %s", testCase.err, err)
+			continue
+		}
+
+		expected := errorResponse{
+			Code:      testCase.code,
+			Message:   testCase.err.Error(),
+			RequestID: w.Header().Get("X-Request-Id"),
+		}
+		if *response != expected || expected.RequestID == "" {
+			t.Errorf("response for [%s] is %+v instead of %+v", testCase.err, response, expected)
+		}
+	}
+}
+
+func TestJSONHandler_Success(t *testing.T) {
+	handler := jsonHandler(func(r *http.Request, params httprouter.Params) (interface{}, error) {
+		return []int{1, 2}, nil
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/foo", nil), nil)
+
+	if w.Code != http.StatusOK || w.Body.String() != "[\n    1,\n    2\n]" {
+		t.Errorf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+}
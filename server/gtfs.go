@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DexterLB/skgt_api/delays"
+	"github.com/DexterLB/skgt_api/gtfs"
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/julienschmidt/httprouter"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func (s *Server) tripUpdates(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	feed, err := s.tripUpdatesFeed(r)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("unable to build feed: %s", err))
+		return
+	}
+
+	data, err := proto.Marshal(feed)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error marshaling feed: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(data)
+}
+
+func (s *Server) tripUpdatesJSON(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	feed, err := s.tripUpdatesFeed(r)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("unable to build feed: %s", err))
+		return
+	}
+
+	data, err := protojson.MarshalOptions{Multiline: true, Indent: "    "}.Marshal(feed)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error marshaling feed: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// tripUpdatesFeed gets the realtime arrivals for all stops configured for the
+// GTFS-Realtime feed and builds the feed from them. Stops for which the
+// arrivals can't be obtained are skipped. The lookups are counted as
+// upstream cost of the request.
+func (s *Server) tripUpdatesFeed(r *http.Request) (*gtfsrt.FeedMessage, error) {
+	now := time.Now().In(location)
+
+	stops := s.config.Server.GTFSRealtimeStops
+	parallelRequests := s.config.Parser.ParallelRequests
+	if parallelRequests < 1 {
+		parallelRequests = 1
+	}
+
+	in := make(chan int, len(stops))
+	for _, stopID := range stops {
+		in <- stopID
+	}
+	close(in)
+
+	var (
+		predictions []*delays.StopPredictions
+		backendErr  error
+		mutex       sync.Mutex
+	)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(parallelRequests)
+	for i := 0; i < parallelRequests; i++ {
+		go func() {
+			defer wg.Done()
+
+			for stopID := range in {
+				stopTimes, err := s.backend.StopTimes(stopID, now, s.calendar)
+				if err != nil {
+					mutex.Lock()
+					backendErr = err
+					mutex.Unlock()
+					continue
+				}
+
+				arrivals, _, fresh, err := s.arrivals.lookup(stopID)
+				if fresh {
+					addUpstreamCost(r, 1)
+				}
+				if err != nil {
+					log.Printf("warning: skipping stop %04d in GTFS-Realtime feed: %s", stopID, err)
+					continue
+				}
+
+				mutex.Lock()
+				predictions = append(predictions, &delays.StopPredictions{
+					StopID:    stopID,
+					Arrivals:  arrivals,
+					StopTimes: stopTimes,
+				})
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if backendErr != nil {
+		return nil, backendErr
+	}
+
+	return gtfs.TripUpdates(predictions, now), nil
+}
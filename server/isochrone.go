@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DexterLB/skgt_api/planner"
+	"github.com/DexterLB/skgt_api/schedules"
+	"github.com/julienschmidt/httprouter"
+)
+
+const defaultIsochroneMinutes = 30
+
+// geoJSONFeatureCollection is a GeoJSON (RFC 7946) collection of points
+type geoJSONFeatureCollection struct {
+	Type     string            `json:"type"`
+	Features []*geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string        `json:"type"`
+	Geometry   *geoJSONPoint `json:"geometry"`
+	Properties interface{}   `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"` // longitude, latitude
+}
+
+// reachProperties are the properties of a reachable stop in GeoJSON
+type reachProperties struct {
+	Stop      int
+	Name      string
+	Arrival   *schedules.Time
+	Minutes   int
+	Transfers int
+}
+
+func (s *Server) isochrone(r *http.Request, params httprouter.Params) (interface{}, error) {
+	query := r.URL.Query()
+
+	lang, err := requestLanguage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := s.queryStop(query.Get("from"))
+	if err != nil {
+		return nil, err
+	}
+
+	p, depart, err := s.journeyPlanner(query, time.Now().In(location))
+	if err != nil {
+		return nil, err
+	}
+
+	minutes := defaultIsochroneMinutes
+	if query.Get("minutes") != "" {
+		minutes, err = strconv.Atoi(query.Get("minutes"))
+		if err != nil || minutes <= 0 || minutes > maxJourneyMinutes {
+			return nil, badRequest(
+				"invalid number of minutes [%s] (must be at most %d)",
+				query.Get("minutes"), maxJourneyMinutes,
+			)
+		}
+	}
+
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "geojson" {
+		return nil, badRequest("unknown format [%s] (must be json or geojson)", format)
+	}
+
+	reachable := p.Reachable(from, depart, minutes)
+	for _, reach := range reachable {
+		localiseStops(lang, reach.Stop)
+	}
+
+	if format == "geojson" {
+		return reachableGeoJSON(reachable), nil
+	}
+	return reachable, nil
+}
+
+// reachableGeoJSON converts reachable stops to GeoJSON points, skipping
+// stops without coordinates
+func reachableGeoJSON(reachable []*planner.Reach) *geoJSONFeatureCollection {
+	collection := &geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: []*geoJSONFeature{},
+	}
+
+	for _, reach := range reachable {
+		if reach.Stop.Latitude == 0 && reach.Stop.Longitude == 0 {
+			continue
+		}
+
+		collection.Features = append(collection.Features, &geoJSONFeature{
+			Type: "Feature",
+			Geometry: &geoJSONPoint{
+				Type:        "Point",
+				Coordinates: []float64{reach.Stop.Longitude, reach.Stop.Latitude},
+			},
+			Properties: &reachProperties{
+				Stop:      reach.Stop.ID,
+				Name:      reach.Stop.Name,
+				Arrival:   reach.Arrival,
+				Minutes:   reach.Minutes,
+				Transfers: reach.Transfers,
+			},
+		})
+	}
+
+	return collection
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/planner"
+	"github.com/DexterLB/skgt_api/schedules"
+)
+
+func TestReachableGeoJSON(t *testing.T) {
+	collection := reachableGeoJSON([]*planner.Reach{
+		{
+			Stop:    &common.Stop{ID: 1, Name: "foo", Latitude: 42.7, Longitude: 23.3},
+			Arrival: schedules.NewTime(8, 15),
+			Minutes: 15,
+		},
+		{
+			Stop:    &common.Stop{ID: 2, Name: "nowhere"},
+			Arrival: schedules.NewTime(8, 20),
+			Minutes: 20,
+		},
+	})
+
+	data, err := json.Marshal(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"type":"FeatureCollection","features":[{"type":"Feature",` +
+		`"geometry":{"type":"Point","coordinates":[23.3,42.7]},` +
+		`"properties":{"Stop":1,"Name":"foo","Arrival":"08:15","Minutes":15,"Transfers":0}}]}`
+	if strings.TrimSpace(string(data)) != expected {
+		t.Errorf("wrong GeoJSON:\n%s\nexpected:\n%s", data, expected)
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/DexterLB/skgt_api/common"
+)
+
+const (
+	langBulgarian = "bg"
+	langEnglish   = "en"
+)
+
+// requestLanguage returns the language requested with the "lang" query
+// parameter (Bulgarian by default)
+func requestLanguage(r *http.Request) (string, error) {
+	switch lang := r.URL.Query().Get("lang"); lang {
+	case "", langBulgarian:
+		return langBulgarian, nil
+	case langEnglish:
+		return langEnglish, nil
+	default:
+		return "", badRequest("unsupported language [%s]", lang)
+	}
+}
+
+// localiseStops changes the names of the given stops according to the
+// language. English prefers the international names of stops.
+func localiseStops(lang string, stops ...*common.Stop) {
+	if lang != langEnglish {
+		return
+	}
+
+	for _, stop := range stops {
+		if stop.InternationalName != "" {
+			stop.Name = stop.InternationalName
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/DexterLB/skgt_api/backend"
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/schedules"
+	"github.com/julienschmidt/httprouter"
+)
+
+// endpoint describes a route in the OpenAPI specification
+type endpoint struct {
+	method  string
+	path    string
+	summary string
+	// description contains details which don't fit in the summary
+	description string
+	query       []parameter
+	// response is a value of the type returned by the route
+	// (a string for plain text responses)
+	response interface{}
+	// contentType is the type of the response ("application/json"
+	// if empty)
+	contentType string
+	// scope is the scope an API key must have to access the endpoint
+	scope backend.Scope
+	// public endpoints don't require an API key
+	public bool
+}
+
+// parameter is a query parameter of an endpoint
+type parameter struct {
+	name        string
+	kind        string
+	description string
+	required    bool
+}
+
+// schema is a JSON schema object
+type schema map[string]interface{}
+
+// route registers a handler and its description. All routes must be
+// registered this way, so that the specification describes every one of them.
+func (s *Server) route(method string, path string, handle httprouter.Handle, doc *endpoint) {
+	doc.method = method
+	doc.path = path
+	s.endpoints = append(s.endpoints, doc)
+
+	if !doc.public {
+		handle = s.authorised(doc, handle)
+	}
+	s.router.Handle(method, path, handle)
+}
+
+func (s *Server) openAPI(r *http.Request, params httprouter.Params) (interface{}, error) {
+	return s.openAPISpec(), nil
+}
+
+// openAPISpec builds the OpenAPI specification of all registered routes
+func (s *Server) openAPISpec() schema {
+	components := make(schema)
+	components["ErrorResponse"] = schemaOf(reflect.TypeOf(errorResponse{}), components, true)
+
+	paths := make(schema)
+	for _, endpoint := range s.endpoints {
+		path := openAPIPath(endpoint.path)
+		if paths[path] == nil {
+			paths[path] = make(schema)
+		}
+		paths[path].(schema)[strings.ToLower(endpoint.method)] = endpoint.operation(components)
+	}
+
+	return schema{
+		"openapi": "3.0.3",
+		"info": schema{
+			"title":       "SKGT API",
+			"description": "API for the sofia public transport",
+			"version":     "1",
+		},
+		"paths": paths,
+		"components": schema{
+			"schemas": components,
+			"securitySchemes": schema{
+				"apiKeyHeader": schema{"type": "apiKey", "in": "header", "name": "X-Api-Key"},
+				"apiKeyQuery":  schema{"type": "apiKey", "in": "query", "name": "api_key"},
+				"basicAuth":    schema{"type": "http", "scheme": "basic"},
+			},
+		},
+		"security": []schema{
+			{"apiKeyHeader": []string{}},
+			{"apiKeyQuery": []string{}},
+			{"basicAuth": []string{}},
+		},
+	}
+}
+
+func (e *endpoint) operation(components schema) schema {
+	var parameters []schema
+	for _, segment := range strings.Split(e.path, "/") {
+		if strings.HasPrefix(segment, ":") {
+			parameters = append(parameters, schema{
+				"name":     segment[1:],
+				"in":       "path",
+				"required": true,
+				"schema":   schema{"type": "string"},
+			})
+		}
+	}
+	for _, parameter := range e.query {
+		parameters = append(parameters, schema{
+			"name":        parameter.name,
+			"in":          "query",
+			"description": parameter.description,
+			"required":    parameter.required,
+			"schema":      schema{"type": parameter.kind},
+		})
+	}
+
+	contentType := e.contentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	operation := schema{
+		"summary": e.summary,
+		"responses": schema{
+			"200": schema{
+				"description": "OK",
+				"content": schema{
+					contentType: schema{
+						"schema": schemaOf(reflect.TypeOf(e.response), components, false),
+					},
+				},
+			},
+			"default": schema{
+				"description": "Error",
+				"content": schema{
+					"application/json": schema{
+						"schema": schema{"$ref": "#/components/schemas/ErrorResponse"},
+					},
+				},
+			},
+		},
+	}
+
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	description := e.description
+	if e.public {
+		operation["security"] = []schema{}
+	} else {
+		description = strings.TrimSpace(fmt.Sprintf(
+			"%s Requires an API key with the %s scope.", description, e.scope,
+		))
+	}
+	if description != "" {
+		operation["description"] = description
+	}
+
+	return operation
+}
+
+// openAPIPath converts a httprouter path to an OpenAPI one
+// ("/stop/:stop_id" to "/stop/{stop_id}")
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// customSchemas are the schemas of types with custom JSON representation
+var customSchemas = map[reflect.Type]schema{
+	reflect.TypeOf(time.Time{}): {"type": "string", "format": "date-time"},
+	reflect.TypeOf(schedules.Time{}): {
+		"type":     "string",
+		"pattern":  `^\d{2}:\d{2}$`,
+		"nullable": true,
+	},
+	reflect.TypeOf(common.Bus): enumSchema(
+		common.Bus, common.Tram, common.Trolley, common.Subway,
+	),
+	reflect.TypeOf(schedules.None): enumSchema(
+		schedules.None, schedules.Workday, schedules.Holiday, schedules.PreHoliday,
+		schedules.HolidayAndPreHoliday, schedules.All,
+	),
+}
+
+func enumSchema(values ...interface{}) schema {
+	names := make([]string, len(values))
+	for i, value := range values {
+		data, _ := json.Marshal(value)
+		_ = json.Unmarshal(data, &names[i])
+	}
+	return schema{"type": "string", "enum": names}
+}
+
+// schemaOf returns the schema of a type. Named structs are added to
+// components and referenced (or inlined if inline is set).
+func schemaOf(t reflect.Type, components schema, inline bool) schema {
+	if t == nil {
+		return schema{"type": "object"}
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if custom, ok := customSchemas[t]; ok {
+		return custom
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return schema{"type": "array", "items": schemaOf(t.Elem(), components, false)}
+	case reflect.Map:
+		return schema{
+			"type":                 "object",
+			"additionalProperties": schemaOf(t.Elem(), components, false),
+		}
+	case reflect.Struct:
+		if inline || t.Name() == "" {
+			return structSchema(t, components)
+		}
+
+		name := t.String()
+		if _, ok := components[name]; !ok {
+			// reserve the name first, in case the type is recursive
+			components[name] = schema{}
+			components[name] = structSchema(t, components)
+		}
+		return schema{"$ref": "#/components/schemas/" + name}
+	default:
+		return schema{}
+	}
+}
+
+func structSchema(t reflect.Type, components schema) schema {
+	properties := make(schema)
+	addProperties(t, properties, components)
+
+	return schema{"type": "object", "properties": properties}
+}
+
+// addProperties adds the schemas of all fields which appear in the JSON
+// representation of a struct
+func addProperties(t reflect.Type, properties schema, components schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := field.Name
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		if tag[0] != "" {
+			name = tag[0]
+		}
+
+		if field.Anonymous && tag[0] == "" && field.Type.Kind() == reflect.Struct {
+			addProperties(field.Type, properties, components)
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+
+		properties[name] = schemaOf(field.Type, components, false)
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func testServer() *Server {
+	s := &Server{router: httprouter.New()}
+	s.registerRoutes()
+	return s
+}
+
+func TestOpenAPI_AllRoutesDocumented(t *testing.T) {
+	s := testServer()
+
+	for _, endpoint := range s.endpoints {
+		if endpoint.summary == "" {
+			t.Errorf("%s %s has no summary", endpoint.method, endpoint.path)
+		}
+		if endpoint.response == nil {
+			t.Errorf("%s %s has no response type", endpoint.method, endpoint.path)
+		}
+		if endpoint.scope == "" && !endpoint.public {
+			t.Errorf("%s %s has no scope", endpoint.method, endpoint.path)
+		}
+	}
+
+	paths := s.openAPISpec()["paths"].(schema)
+	for _, endpoint := range s.endpoints {
+		path, ok := paths[openAPIPath(endpoint.path)].(schema)
+		if !ok || path[strings.ToLower(endpoint.method)] == nil {
+			t.Errorf("%s %s is missing from the specification", endpoint.method, endpoint.path)
+		}
+	}
+}
+
+// TestOpenAPI_NoUndocumentedRoutes makes sure that all routes are
+// registered with Server.route, which adds them to the specification
+func TestOpenAPI_NoUndocumentedRoutes(t *testing.T) {
+	fileSet := token.NewFileSet()
+	packages, err := parser.ParseDir(fileSet, ".", func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatalf("unable to parse package: %s", err)
+	}
+
+	registerMethods := map[string]bool{
+		"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true,
+		"HEAD": true, "OPTIONS": true, "Handle": true, "Handler": true,
+		"HandlerFunc": true, "ServeFiles": true,
+	}
+
+	for _, pkg := range packages {
+		for _, file := range pkg.Files {
+			for _, declaration := range file.Decls {
+				function, ok := declaration.(*ast.FuncDecl)
+				if !ok || function.Name.Name == "route" {
+					continue
+				}
+
+				ast.Inspect(function, func(node ast.Node) bool {
+					call, ok := node.(*ast.CallExpr)
+					if !ok {
+						return true
+					}
+					selector, ok := call.Fun.(*ast.SelectorExpr)
+					if ok && registerMethods[selector.Sel.Name] && len(call.Args) >= 2 {
+						t.Errorf(
+							"%s: route registered with %s instead of Server.route",
+							fileSet.Position(call.Pos()), selector.Sel.Name,
+						)
+					}
+					return true
+				})
+			}
+		}
+	}
+}
+
+func TestOpenAPI_Schemas(t *testing.T) {
+	s := testServer()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/openapi.json", nil)
+	s.ServeHTTP(w, r)
+
+	if w.Code != 200 {
+		t.Fatalf("/openapi.json returned %d without an API key: %s", w.Code, w.Body.String())
+	}
+
+	spec := make(map[string]interface{})
+	err := json.Unmarshal(w.Body.Bytes(), &spec)
+	if err != nil {
+		t.Fatalf("specification is not valid JSON: %s", err)
+	}
+
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	for name, fields := range map[string][]string{
+		"common.Line":           {"Vehicle", "Number"},
+		"common.Route":          {"Direction", "Stops"},
+		"common.Stop":           {"ID", "Name", "Latitude", "Longitude"},
+		"realtime.LineArrivals": {"Line", "Arrivals"},
+		"realtime.Arrival":      {"Time", "Calculated"},
+	} {
+		component, ok := schemas[name].(map[string]interface{})
+		if !ok {
+			t.Errorf("no schema for %s", name)
+			continue
+		}
+
+		properties := component["properties"].(map[string]interface{})
+		for _, field := range fields {
+			if properties[field] == nil {
+				t.Errorf("schema for %s has no property %s", name, field)
+			}
+		}
+	}
+
+	vehicle := schemas["common.Line"].(map[string]interface{})["properties"].(map[string]interface{})["Vehicle"]
+	data, _ := json.Marshal(vehicle)
+	if !strings.Contains(string(data), `"Tram"`) {
+		t.Errorf("vehicle type is not described as an enum: %s", data)
+	}
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	path := openAPIPath("/transport/line/:vehicle/:number/routes")
+	if path != "/transport/line/{vehicle}/{number}/routes" {
+		t.Errorf("wrong path: %s", path)
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DexterLB/skgt_api/planner"
+	"github.com/DexterLB/skgt_api/schedules"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// plannerTTL is for how long a loaded timetable is used before it's
+	// loaded again, so that updates are picked up
+	plannerTTL = time.Hour
+	// maxJourneyMinutes is the longest journey the planner looks for
+	maxJourneyMinutes = 3 * 60
+	defaultPlanLimit  = 3
+	maxPlanLimit      = 10
+)
+
+// plannerCache keeps a journey planner for each day type. Concurrent
+// requests for a day type which isn't loaded share a single load.
+type plannerCache struct {
+	ttl  time.Duration
+	load func(dayType schedules.ScheduleType) (*planner.Planner, error)
+
+	mutex   sync.Mutex
+	entries map[schedules.ScheduleType]*plannerEntry
+}
+
+type plannerEntry struct {
+	done    chan struct{}
+	planner *planner.Planner
+	err     error
+	loaded  time.Time
+}
+
+func newPlannerCache(
+	ttl time.Duration,
+	load func(dayType schedules.ScheduleType) (*planner.Planner, error),
+) *plannerCache {
+	return &plannerCache{
+		ttl:     ttl,
+		load:    load,
+		entries: make(map[schedules.ScheduleType]*plannerEntry),
+	}
+}
+
+// get returns the planner for the given day type, loading it if it isn't
+// loaded or is too old
+func (c *plannerCache) get(dayType schedules.ScheduleType) (*planner.Planner, error) {
+	c.mutex.Lock()
+	entry, ok := c.entries[dayType]
+	owner := !ok || c.expired(entry)
+	if owner {
+		entry = &plannerEntry{done: make(chan struct{})}
+		c.entries[dayType] = entry
+	}
+	c.mutex.Unlock()
+
+	if owner {
+		entry.planner, entry.err = c.load(dayType)
+		entry.loaded = time.Now()
+		close(entry.done)
+	}
+
+	<-entry.done
+	return entry.planner, entry.err
+}
+
+// expired checks if an entry must be loaded again. Entries which are still
+// being loaded are never expired, and failed ones always are.
+func (c *plannerCache) expired(entry *plannerEntry) bool {
+	select {
+	case <-entry.done:
+		return entry.err != nil || time.Since(entry.loaded) >= c.ttl
+	default:
+		return false
+	}
+}
+
+func (s *Server) plan(r *http.Request, params httprouter.Params) (interface{}, error) {
+	query := r.URL.Query()
+
+	lang, err := requestLanguage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := s.queryStop(query.Get("from"))
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := s.queryStop(query.Get("to"))
+	if err != nil {
+		return nil, err
+	}
+
+	p, depart, err := s.journeyPlanner(query, time.Now().In(location))
+	if err != nil {
+		return nil, err
+	}
+
+	limit := defaultPlanLimit
+	if query.Get("limit") != "" {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 || limit > maxPlanLimit {
+			return nil, badRequest(
+				"invalid limit [%s] (must be at most %d)",
+				query.Get("limit"), maxPlanLimit,
+			)
+		}
+	}
+
+	itineraries := p.Plan(from, to, depart, maxJourneyMinutes, limit)
+	if itineraries == nil {
+		itineraries = []*planner.Itinerary{}
+	}
+
+	for _, itinerary := range itineraries {
+		for _, leg := range itinerary.Legs {
+			localiseStops(lang, leg.From, leg.To)
+		}
+	}
+
+	return itineraries, nil
+}
+
+// queryStop parses a stop ID from a query parameter and checks that the
+// stop exists
+func (s *Server) queryStop(input string) (int, error) {
+	stopID, err := strconv.Atoi(input)
+	if err != nil {
+		return 0, badRequest("unable to parse stop ID [%s]", input)
+	}
+
+	err = s.backend.CheckStop(stopID)
+	if err != nil {
+		return 0, err
+	}
+
+	return stopID, nil
+}
+
+// journeyPlanner returns the planner and the departure time of a journey
+// (see departure). When neither the day type nor the date is given and the
+// departure is before the first one of the service day, the journey is
+// planned over the previous service day, whose courses run past midnight.
+func (s *Server) journeyPlanner(query url.Values, now time.Time) (*planner.Planner, int, error) {
+	depart, dayType, err := s.departure(query, now)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	p, err := s.planners.get(dayType)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not load timetable: %s", err)
+	}
+
+	if query.Get("day_type") != "" || query.Get("date") != "" || depart >= p.FirstDeparture() {
+		return p, depart, nil
+	}
+
+	p, err = s.planners.get(s.calendar.DayType(now.AddDate(0, 0, -1)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not load timetable: %s", err)
+	}
+
+	return p, depart + 24*60, nil
+}
+
+// departure parses the departure time (in minutes since midnight) and day
+// type of a journey, which are now and today's day type by default. Only a
+// single day type is accepted.
+func (s *Server) departure(query url.Values, now time.Time) (int, schedules.ScheduleType, error) {
+	depart := now.Hour()*60 + now.Minute()
+	if query.Get("depart") != "" {
+		clock, err := schedules.ParseClock(query.Get("depart"))
+		if err != nil {
+			return 0, schedules.None, badRequest("could not parse departure time: %s", err)
+		}
+		depart = clock.Hours*60 + clock.Minutes
+	}
+
+	dayType, err := s.queryDayType(query, s.calendar.DayType(now))
+	if err != nil {
+		return 0, schedules.None, err
+	}
+
+	// a combined day type would mix the services of different days
+	switch dayType {
+	case schedules.Workday, schedules.Holiday, schedules.PreHoliday:
+	default:
+		return 0, schedules.None, badRequest(
+			"day type must be workday, holiday or preholiday, not %s", dayType,
+		)
+	}
+
+	return depart, dayType, nil
+}
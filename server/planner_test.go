@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/calendar"
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/planner"
+	"github.com/DexterLB/skgt_api/schedules"
+)
+
+func TestDeparture(t *testing.T) {
+	s := &Server{calendar: calendar.New(nil)}
+	now := time.Date(2017, 3, 13, 10, 0, 0, 0, location)
+
+	values, _ := url.ParseQuery("depart=08:15&day_type=holiday")
+	depart, dayType, err := s.departure(values, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depart != 8*60+15 || dayType != schedules.Holiday {
+		t.Errorf("wrong departure: %d on %s", depart, dayType)
+	}
+
+	for _, query := range []string{
+		"day_type=all",
+		"day_type=holidayandpreholiday",
+		"depart=8",
+	} {
+		values, _ := url.ParseQuery(query)
+		_, _, err := s.departure(values, now)
+		if err == nil || toAPIError(err).code != codeBadRequest {
+			t.Errorf("%s: expected a bad request, got %v", query, err)
+		}
+	}
+}
+
+func TestJourneyPlanner(t *testing.T) {
+	line := common.Line{Vehicle: common.Bus, Number: "N1"}
+	planners := map[schedules.ScheduleType]*planner.Planner{
+		schedules.Workday: planner.New(nil, []*planner.Connection{
+			{"workday", line, "A - B", 1, 2, 5 * 60, 5*60 + 10},
+		}),
+		schedules.Holiday: planner.New(nil, []*planner.Connection{
+			{"holiday", line, "A - B", 1, 2, 24*60 + 40, 24*60 + 50},
+		}),
+	}
+
+	s := &Server{
+		calendar: calendar.New(nil),
+		planners: newPlannerCache(time.Hour, func(dayType schedules.ScheduleType) (*planner.Planner, error) {
+			return planners[dayType], nil
+		}),
+	}
+
+	// the 13th is a monday, so the previous service day is a holiday
+	for _, test := range []struct {
+		query   string
+		now     time.Time
+		planner schedules.ScheduleType
+		depart  int
+	}{
+		{"", time.Date(2017, 3, 13, 10, 0, 0, 0, location), schedules.Workday, 10 * 60},
+		{"", time.Date(2017, 3, 13, 0, 30, 0, 0, location), schedules.Holiday, 24*60 + 30},
+		{"depart=00:20", time.Date(2017, 3, 13, 10, 0, 0, 0, location), schedules.Holiday, 24*60 + 20},
+		{"day_type=workday", time.Date(2017, 3, 13, 0, 30, 0, 0, location), schedules.Workday, 30},
+	} {
+		values, _ := url.ParseQuery(test.query)
+		p, depart, err := s.journeyPlanner(values, test.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p != planners[test.planner] || depart != test.depart {
+			t.Errorf(
+				"%s at %s: planned at %d instead of %d on %s",
+				test.query, test.now, depart, test.depart, test.planner,
+			)
+		}
+	}
+}
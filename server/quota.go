@@ -0,0 +1,92 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// quota limits the number of requests each API key may make per day. The
+// count for a day starts from the usage stored in the database, so that it
+// survives restarts, and is then kept in memory.
+type quota struct {
+	limit int64
+	load  func(apiKey int64, day time.Time) (int64, error)
+	now   func() time.Time
+
+	mutex  sync.Mutex
+	counts map[int64]*dailyCount
+}
+
+type dailyCount struct {
+	day      string
+	requests int64
+}
+
+// quotaStatus is the state of a key's quota after a request
+type quotaStatus struct {
+	allowed   bool
+	limit     int64
+	remaining int64
+	reset     time.Duration // until the next day
+}
+
+// newQuota returns a quota of requestsPerDay requests, or nil if
+// requestsPerDay isn't positive
+func newQuota(requestsPerDay int, load func(apiKey int64, day time.Time) (int64, error)) *quota {
+	if requestsPerDay <= 0 {
+		return nil
+	}
+
+	return &quota{
+		limit:  int64(requestsPerDay),
+		load:   load,
+		now:    time.Now,
+		counts: make(map[int64]*dailyCount),
+	}
+}
+
+// take counts a request made with the given key, unless the key has used
+// up its quota for the day
+func (q *quota) take(key int64) (*quotaStatus, error) {
+	now := q.now()
+	day := now.Format("2006-01-02")
+
+	q.mutex.Lock()
+	count, ok := q.counts[key]
+	q.mutex.Unlock()
+
+	if !ok || count.day != day {
+		requests, err := q.load(key, now)
+		if err != nil {
+			return nil, err
+		}
+
+		q.mutex.Lock()
+		// another request may have loaded the count in the meantime
+		count, ok = q.counts[key]
+		if !ok || count.day != day {
+			count = &dailyCount{day: day, requests: requests}
+			q.counts[key] = count
+		}
+		q.mutex.Unlock()
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	status := &quotaStatus{limit: q.limit}
+	if count.requests < q.limit {
+		count.requests++
+		status.allowed = true
+	}
+
+	status.remaining = q.limit - count.requests
+	if status.remaining < 0 {
+		status.remaining = 0
+	}
+
+	year, month, date := now.Date()
+	status.reset = time.Date(year, month, date+1, 0, 0, 0, 0, now.Location()).Sub(now)
+
+	return status, nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/backend"
+)
+
+func testQuota(requestsPerDay int, stored int64) (*quota, *time.Time) {
+	now := time.Date(2017, 3, 1, 18, 0, 0, 0, time.UTC)
+	q := newQuota(requestsPerDay, func(apiKey int64, day time.Time) (int64, error) {
+		if apiKey == 1 && day.Day() == 1 {
+			return stored, nil
+		}
+		return 0, nil
+	})
+	q.now = func() time.Time { return now }
+	return q, &now
+}
+
+func TestQuota(t *testing.T) {
+	q, now := testQuota(3, 1)
+
+	for i := 0; i < 2; i++ {
+		status, err := q.take(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.allowed {
+			t.Fatalf("request %d within quota was not allowed", i)
+		}
+		if status.remaining != int64(1-i) {
+			t.Errorf("%d requests remaining after request %d", status.remaining, i)
+		}
+	}
+
+	status, _ := q.take(1)
+	if status.allowed {
+		t.Fatalf("request over quota was allowed")
+	}
+	if status.reset != 6*time.Hour {
+		t.Errorf("quota resets in %s instead of 6h", status.reset)
+	}
+
+	status, _ = q.take(2)
+	if !status.allowed || status.remaining != 2 {
+		t.Errorf("other key has the wrong quota: %+v", status)
+	}
+
+	*now = now.Add(7 * time.Hour)
+	status, _ = q.take(1)
+	if !status.allowed || status.remaining != 2 {
+		t.Errorf("quota wasn't renewed on the next day: %+v", status)
+	}
+}
+
+func TestQuota_LoadError(t *testing.T) {
+	q := newQuota(3, func(apiKey int64, day time.Time) (int64, error) {
+		return 0, fmt.Errorf("no database")
+	})
+
+	_, err := q.take(1)
+	if err == nil {
+		t.Errorf("no error when the usage can't be loaded")
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	if checkQuota(httptest.NewRecorder(), newQuota(0, nil), &backend.APIKey{ID: 42}) != nil {
+		t.Errorf("request was limited without a quota")
+	}
+
+	q, _ := testQuota(1, 0)
+	key := &backend.APIKey{ID: 42}
+
+	w := httptest.NewRecorder()
+	err := checkQuota(w, q, key)
+	if err != nil {
+		t.Fatalf("first request was limited: %s", err)
+	}
+
+	w = httptest.NewRecorder()
+	err = checkQuota(w, q, key)
+	if err == nil || toAPIError(err).status != http.StatusTooManyRequests ||
+		toAPIError(err).code != codeQuotaExceeded {
+		t.Fatalf("wrong error for second request: %v", err)
+	}
+
+	for header, value := range map[string]string{
+		"Retry-After":       "21600",
+		"X-Quota-Limit":     "1",
+		"X-Quota-Remaining": "0",
+		"X-Quota-Reset":     "21600",
+	} {
+		if w.Header().Get(header) != value {
+			t.Errorf("%s is [%s] instead of [%s]", header, w.Header().Get(header), value)
+		}
+	}
+}
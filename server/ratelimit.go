@@ -0,0 +1,95 @@
+package server
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Default rate limits, used when none are configured
+const (
+	defaultRateLimit              = 60 // requests per minute
+	defaultRateLimitBurst         = 30
+	defaultRealtimeRateLimit      = 6
+	defaultRealtimeRateLimitBurst = 3
+)
+
+// rateLimiter is a token bucket rate limiter with a separate bucket for
+// each API key. Each bucket holds at most burst tokens and is refilled with
+// rate tokens per second. Each request takes a token.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mutex   sync.Mutex
+	buckets map[int64]*bucket
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimitStatus is the state of a bucket after a request
+type rateLimitStatus struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	retryAfter time.Duration // until the next token, if not allowed
+	reset      time.Duration // until the bucket is full
+}
+
+// newRateLimiter returns a limiter which allows requestsPerMinute requests
+// on average and at most burst requests at once. Non-positive values are
+// replaced by the given defaults.
+func newRateLimiter(requestsPerMinute int, burst int, defaultRate int, defaultBurst int) *rateLimiter {
+	if requestsPerMinute <= 0 {
+		requestsPerMinute = defaultRate
+	}
+	if burst <= 0 {
+		burst = defaultBurst
+	}
+
+	return &rateLimiter{
+		rate:    float64(requestsPerMinute) / 60,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[int64]*bucket),
+	}
+}
+
+// take takes a token from the bucket of the given key
+func (l *rateLimiter) take(key int64) *rateLimitStatus {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	status := &rateLimitStatus{limit: int(l.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		status.allowed = true
+	} else {
+		status.retryAfter = l.until(1 - b.tokens)
+	}
+
+	status.remaining = int(b.tokens)
+	status.reset = l.until(l.burst - b.tokens)
+
+	return status
+}
+
+// until returns the time needed for the given number of tokens to be added
+func (l *rateLimiter) until(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
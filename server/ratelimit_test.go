@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/backend"
+)
+
+func testRateLimiter(requestsPerMinute int, burst int) (*rateLimiter, *time.Time) {
+	now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(requestsPerMinute, burst, 1, 1)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter, now := testRateLimiter(60, 3)
+
+	for i := 0; i < 3; i++ {
+		status := limiter.take(1)
+		if !status.allowed {
+			t.Fatalf("request %d within burst was not allowed", i)
+		}
+		if status.remaining != 2-i {
+			t.Errorf("%d requests remaining after request %d", status.remaining, i)
+		}
+	}
+
+	status := limiter.take(1)
+	if status.allowed {
+		t.Fatalf("request over burst was allowed")
+	}
+	if status.retryAfter != time.Second {
+		t.Errorf("retry after %s instead of 1s", status.retryAfter)
+	}
+
+	if !limiter.take(2).allowed {
+		t.Errorf("other key was limited")
+	}
+
+	*now = now.Add(1500 * time.Millisecond)
+	if !limiter.take(1).allowed {
+		t.Errorf("request was not allowed after refill")
+	}
+	if limiter.take(1).allowed {
+		t.Errorf("bucket was refilled too much")
+	}
+
+	*now = now.Add(time.Hour)
+	status = limiter.take(1)
+	if !status.allowed || status.remaining != 2 {
+		t.Errorf("bucket overflowed: %+v", status)
+	}
+}
+
+func TestCheckRateLimit(t *testing.T) {
+	limiter, _ := testRateLimiter(6, 1)
+	key := &backend.APIKey{ID: 42}
+
+	w := httptest.NewRecorder()
+	err := checkRateLimit(w, limiter, key)
+	if err != nil {
+		t.Fatalf("first request was limited: %s", err)
+	}
+
+	w = httptest.NewRecorder()
+	err = checkRateLimit(w, limiter, key)
+	if err == nil || toAPIError(err).status != http.StatusTooManyRequests {
+		t.Fatalf("wrong error for second request: %v", err)
+	}
+
+	for header, value := range map[string]string{
+		"Retry-After":           "10",
+		"X-RateLimit-Limit":     "1",
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     "10",
+	} {
+		if w.Header().Get(header) != value {
+			t.Errorf("%s is [%s] instead of [%s]", header, w.Header().Get(header), value)
+		}
+	}
+}
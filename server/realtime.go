@@ -2,19 +2,58 @@ package server
 
 import (
 	"fmt"
+	"net/http"
 	"strconv"
+	"time"
 
-	"github.com/DexterLB/skgt_api/realtime"
+	"github.com/DexterLB/skgt_api/delays"
 	"github.com/julienschmidt/httprouter"
 )
 
-func (s *Server) realtimeArrivals(params httprouter.Params) (interface{}, error) {
+func (s *Server) realtimeArrivals(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	stopID, err := strconv.Atoi(params.ByName("stop_id"))
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse stop ID: %s", err)
+		writeError(w, r, badRequest("unable to parse stop ID: %s", err))
+		return
 	}
 
-	arrivals, err := realtime.AllArrivals(s.parserSettings, stopID)
+	err = s.backend.CheckStop(stopID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	arrivals, fetched, fresh, err := s.arrivals.lookup(stopID)
+	if fresh {
+		addUpstreamCost(r, 1)
+	}
+	if err != nil {
+		writeError(w, r, upstreamError("unable to get realtime arrivals: %s", err))
+		return
+	}
+
+	stopTimes, err := s.backend.StopTimes(stopID, time.Now().In(location), s.calendar)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("unable to get stop times: %s", err))
+		return
+	}
+
+	arrivals = delays.Estimate(&delays.StopPredictions{
+		StopID:    stopID,
+		Arrivals:  arrivals,
+		StopTimes: stopTimes,
+	})
+
+	age := time.Since(fetched)
+	maxAge := s.arrivals.ttl - age
+	if maxAge < 0 {
+		maxAge = 0
+	}
+
+	// the response is for an authenticated request, so only the client
+	// may cache it
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds())))
+	w.Header().Set("Age", fmt.Sprintf("%d", int(age.Seconds())))
 
-	return arrivals, err
+	writeJSON(w, r, arrivals)
 }
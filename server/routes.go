@@ -2,29 +2,124 @@ package server
 
 import (
 	"fmt"
+	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/DexterLB/skgt_api/backend"
 	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/gtfs"
 	"github.com/julienschmidt/httprouter"
 )
 
-func (s *Server) transports(params httprouter.Params) (interface{}, error) {
+// defaultPunctualityDays is the number of days for which punctuality is
+// returned by default
+const defaultPunctualityDays = 30
+
+var location = gtfs.Location
+
+func (s *Server) transports(r *http.Request, params httprouter.Params) (interface{}, error) {
 	transports, err := s.backend.Transports()
 
 	return transports, err
 }
 
-func (s *Server) routes(params httprouter.Params) (interface{}, error) {
+func (s *Server) routes(r *http.Request, params httprouter.Params) (interface{}, error) {
 	number := params.ByName("number")
 	vehicle, err := common.ParseVehicle(params.ByName("vehicle"))
 
 	if err != nil {
-		return nil, fmt.Errorf("could not parse vehicle type: %s", err)
+		return nil, badRequest("could not parse vehicle type: %s", err)
 	}
 
-	routes, err := s.backend.Routes(number, vehicle)
+	lang, err := requestLanguage(r)
 	if err != nil {
+		return nil, err
+	}
+
+	routes, err := s.backend.Routes(number, vehicle)
+	if err == backend.ErrNoSuchLine {
+		return nil, err
+	} else if err != nil {
 		return nil, fmt.Errorf("could not get routes: %s", err)
 	}
 
+	for _, route := range routes {
+		localiseStops(lang, route.Stops...)
+	}
+
 	return routes, nil
 }
+
+func (s *Server) lineChanges(r *http.Request, params httprouter.Params) (interface{}, error) {
+	number := params.ByName("number")
+	vehicle, err := common.ParseVehicle(params.ByName("vehicle"))
+
+	if err != nil {
+		return nil, badRequest("could not parse vehicle type: %s", err)
+	}
+
+	var since time.Time
+	if r.URL.Query().Get("since") != "" {
+		since, err = time.Parse("2006-01-02", r.URL.Query().Get("since"))
+		if err != nil {
+			return nil, badRequest("could not parse date: %s", err)
+		}
+	}
+
+	changes, err := s.backend.LineChanges(number, vehicle, since)
+	if err == backend.ErrNoSuchLine {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("could not get changes: %s", err)
+	}
+
+	return changes, nil
+}
+
+func (s *Server) punctuality(r *http.Request, params httprouter.Params) (interface{}, error) {
+	number := params.ByName("number")
+	vehicle, err := common.ParseVehicle(params.ByName("vehicle"))
+
+	if err != nil {
+		return nil, badRequest("could not parse vehicle type: %s", err)
+	}
+
+	query := r.URL.Query()
+
+	var stopID *int
+	if query.Get("stop") != "" {
+		id, err := strconv.Atoi(query.Get("stop"))
+		if err != nil {
+			return nil, badRequest("unable to parse stop ID: %s", err)
+		}
+		stopID = &id
+	}
+
+	to := time.Now()
+	if query.Get("to") != "" {
+		to, err = time.ParseInLocation("2006-01-02", query.Get("to"), location)
+		if err != nil {
+			return nil, badRequest("could not parse date: %s", err)
+		}
+		// include the whole day
+		to = to.AddDate(0, 0, 1)
+	}
+
+	from := to.AddDate(0, 0, -defaultPunctualityDays)
+	if query.Get("from") != "" {
+		from, err = time.ParseInLocation("2006-01-02", query.Get("from"), location)
+		if err != nil {
+			return nil, badRequest("could not parse date: %s", err)
+		}
+	}
+
+	punctuality, err := s.backend.Punctuality(number, vehicle, stopID, from, to)
+	if err == backend.ErrNoSuchLine {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("could not get punctuality: %s", err)
+	}
+
+	return punctuality, nil
+}
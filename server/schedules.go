@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/DexterLB/skgt_api/backend"
+	"github.com/DexterLB/skgt_api/calendar"
+	"github.com/DexterLB/skgt_api/schedules"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (s *Server) scheduledArrivals(r *http.Request, params httprouter.Params) (interface{}, error) {
+	stopID, err := strconv.Atoi(params.ByName("stop_id"))
+	if err != nil {
+		return nil, badRequest("unable to parse stop ID: %s", err)
+	}
+
+	query := r.URL.Query()
+
+	dayType, err := s.queryDayType(query, schedules.None)
+	if err != nil {
+		return nil, err
+	}
+
+	var from, to *schedules.Time
+	if query.Get("from") != "" {
+		from, err = schedules.ParseClock(query.Get("from"))
+		if err != nil {
+			return nil, badRequest("could not parse start of time window: %s", err)
+		}
+	}
+	if query.Get("to") != "" {
+		to, err = schedules.ParseClock(query.Get("to"))
+		if err != nil {
+			return nil, badRequest("could not parse end of time window: %s", err)
+		}
+	}
+
+	arrivals, err := s.backend.ScheduledArrivals(stopID, dayType, from, to)
+	if err == backend.ErrNoSuchStop {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("could not get scheduled arrivals: %s", err)
+	}
+
+	return arrivals, nil
+}
+
+// queryDayType returns the day type given in the query either directly
+// (day_type) or by a date (date), or def if neither is given
+func (s *Server) queryDayType(query url.Values, def schedules.ScheduleType) (schedules.ScheduleType, error) {
+	if query.Get("day_type") != "" && query.Get("date") != "" {
+		return schedules.None, badRequest("only one of day_type and date may be given")
+	}
+
+	if query.Get("date") != "" {
+		date, err := time.ParseInLocation(calendar.DateFormat, query.Get("date"), location)
+		if err != nil {
+			return schedules.None, badRequest("could not parse date: %s", err)
+		}
+		return s.calendar.DayType(date), nil
+	}
+
+	if query.Get("day_type") != "" {
+		dayType, err := schedules.ParseScheduleType(query.Get("day_type"))
+		if err != nil {
+			return schedules.None, badRequest("could not parse day type: %s", err)
+		}
+		return dayType, nil
+	}
+
+	return def, nil
+}
@@ -1,12 +1,20 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/DexterLB/htmlparsing"
 	"github.com/DexterLB/skgt_api/backend"
+	"github.com/DexterLB/skgt_api/calendar"
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/config"
+	"github.com/DexterLB/skgt_api/planner"
+	"github.com/DexterLB/skgt_api/realtime"
+	"github.com/DexterLB/skgt_api/schedules"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -14,38 +22,277 @@ import (
 type Server struct {
 	backend        *backend.Backend
 	parserSettings *htmlparsing.Settings
+	captchaSolver  realtime.CaptchaSolver
+	calendar       *calendar.Calendar
+	config         *config.Config
 
-	router *httprouter.Router
+	router    *httprouter.Router
+	endpoints []*endpoint
+	arrivals  *arrivalsCache
+
+	planners *plannerCache
+
+	arrivalsHub *arrivalsHub
+	wsSessions  *sessionStore
+
+	rateLimiter         *rateLimiter
+	realtimeRateLimiter *rateLimiter
+	quota               *quota
+	usage               *usageRecorder
 }
 
 // New returns a new server using the specified backend instance
-func New(backend *backend.Backend, parserSettings *htmlparsing.Settings) *Server {
+func New(
+	backend *backend.Backend,
+	parserSettings *htmlparsing.Settings,
+	captchaSolver realtime.CaptchaSolver,
+	calendar *calendar.Calendar,
+	config *config.Config,
+) *Server {
 	router := httprouter.New()
 	s := &Server{
 		backend:        backend,
 		parserSettings: parserSettings,
+		captchaSolver:  captchaSolver,
+		calendar:       calendar,
+		config:         config,
 		router:         router,
 	}
 
-	router.GET("/info", s.info)
-	router.GET("/stop/:stop_id/arrivals/realtime", jsonHandler(s.realtimeArrivals))
-	router.GET("/transport/line/:vehicle/:number/routes", jsonHandler(s.routes))
-	router.GET("/transport/list/", jsonHandler(s.transports))
+	ttl := time.Duration(config.Server.RealtimeCacheSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultRealtimeCacheTTL
+	}
+	s.arrivals = newArrivalsCache(ttl, func(stopID int) ([]*realtime.LineArrivals, error) {
+		return realtime.AllArrivals(s.parserSettings, s.captchaSolver, stopID)
+	})
+
+	s.planners = newPlannerCache(plannerTTL, backend.Planner)
+
+	pollInterval := time.Duration(config.Server.StreamPollSeconds) * time.Second
+	if pollInterval <= 0 {
+		pollInterval = defaultStreamPollInterval
+	}
+	s.arrivalsHub = newArrivalsHub(pollInterval, func(stopID int) ([]*realtime.LineArrivals, error) {
+		arrivals, _, err := s.arrivals.get(stopID)
+		return arrivals, err
+	})
+
+	s.wsSessions = newSessionStore(sessionTTL)
+
+	s.rateLimiter = newRateLimiter(
+		config.Server.RateLimit, config.Server.RateLimitBurst,
+		defaultRateLimit, defaultRateLimitBurst,
+	)
+	s.realtimeRateLimiter = newRateLimiter(
+		config.Server.RealtimeRateLimit, config.Server.RealtimeRateLimitBurst,
+		defaultRealtimeRateLimit, defaultRealtimeRateLimitBurst,
+	)
+
+	s.quota = newQuota(config.Server.DailyQuota, backend.DailyRequests)
+
+	flushInterval := time.Duration(config.Server.UsageFlushSeconds) * time.Second
+	if flushInterval <= 0 {
+		flushInterval = defaultUsageFlushInterval
+	}
+	s.usage = newUsageRecorder(backend.RecordUsage)
+	go s.usage.run(flushInterval)
+
+	s.registerRoutes()
+
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, notFound("no such endpoint: %s", r.URL.Path))
+	})
 
 	return s
 }
 
+// registerRoutes registers all handlers together with their descriptions
+// for the OpenAPI specification
+func (s *Server) registerRoutes() {
+	s.route("GET", "/info", s.info, &endpoint{
+		scope:       backend.ScopeStatic,
+		summary:     "Information about the server",
+		response:    "",
+		contentType: "text/plain",
+	})
+	s.route("GET", "/openapi.json", jsonHandler(s.openAPI), &endpoint{
+		summary:  "OpenAPI specification of the API",
+		response: map[string]interface{}{},
+		public:   true,
+	})
+	s.route("GET", "/stop/:stop_id/arrivals/realtime", s.realtimeArrivals, &endpoint{
+		scope:   backend.ScopeRealtime,
+		summary: "Realtime arrivals at a stop, from the SKGT virtual board",
+		description: "Arrivals which can be matched to the schedule also have their " +
+			"scheduled time and delay.",
+		response: []*realtime.LineArrivals{},
+	})
+	s.route("GET", "/stop/:stop_id/arrivals/stream", s.streamArrivals, &endpoint{
+		scope:   backend.ScopeRealtime,
+		summary: "Stream of the realtime arrivals at a stop",
+		description: "Server-sent events: \"arrivals\" whenever the arrivals change " +
+			"and \"error\" when they can't be obtained.",
+		response:    []*realtime.LineArrivals{},
+		contentType: "text/event-stream",
+	})
+	s.route("GET", "/arrivals/websocket", s.websocketArrivals, &endpoint{
+		scope:   backend.ScopeRealtime,
+		summary: "WebSocket subscription to the realtime arrivals of lines at stops",
+		description: "Send {\"Type\": \"subscribe\", \"Subscriptions\": [{\"Stop\": ..., \"Line\": ...}]} " +
+			"(or \"unsubscribe\") to choose lines. Every message contains the arrivals which " +
+			"changed since the previous one. To resume a session after reconnecting, pass the " +
+			"token from the welcome message and the last received sequence number. " +
+			"Browsers may only connect from the API's own origin and configured ones.",
+		query: []parameter{
+			{"token", "string", "token of the session to resume", false},
+			{"sequence", "integer", "sequence number of the last message received in the resumed session", false},
+		},
+		response: serverMessage{},
+	})
+	s.route("GET", "/stop/:stop_id/arrivals/scheduled", jsonHandler(s.scheduledArrivals), &endpoint{
+		scope:   backend.ScopeStatic,
+		summary: "Scheduled arrivals at a stop",
+		query: []parameter{
+			{"day_type", "string", "workday, holiday, preholiday, holidayandpreholiday or all", false},
+			{"date", "string", "date whose day type to use instead of day_type (YYYY-MM-DD)", false},
+			{"from", "string", "start of the time window (HH:MM)", false},
+			{"to", "string", "end of the time window (HH:MM)", false},
+		},
+		response: []*schedules.LineArrivals{},
+	})
+	s.route("GET", "/calendar/:date", jsonHandler(s.calendarDay), &endpoint{
+		scope:   backend.ScopeStatic,
+		summary: "Day type of a date (YYYY-MM-DD)",
+		description: "Takes weekends, public holidays (including the ones moved from weekends) " +
+			"and exceptions declared by the operator into account.",
+		response: calendar.Day{},
+	})
+	s.route("GET", "/plan", jsonHandler(s.plan), &endpoint{
+		scope:   backend.ScopeStatic,
+		summary: "Journeys from one stop to another according to the schedule",
+		description: fmt.Sprintf(
+			"Itineraries consist of rides and walks of at most %d metres between nearby "+
+				"stops. Each itinerary departs later than the previous one.",
+			planner.MaxWalkDistance,
+		),
+		query: []parameter{
+			{"from", "integer", "stop to depart from", true},
+			{"to", "integer", "stop to arrive at", true},
+			{"depart", "string", "earliest departure time (HH:MM, now by default)", false},
+			{"day_type", "string", "workday, holiday or preholiday (today's by default)", false},
+			{"date", "string", "date whose day type to use instead of day_type (YYYY-MM-DD)", false},
+			{"limit", "integer", "maximum number of itineraries", false},
+			{"lang", "string", "bg or en", false},
+		},
+		response: []*planner.Itinerary{},
+	})
+	s.route("GET", "/isochrone", jsonHandler(s.isochrone), &endpoint{
+		scope:   backend.ScopeStatic,
+		summary: "Stops which can be reached from a stop within some time according to the schedule",
+		description: "Stops are ordered by their earliest arrival time. With format=geojson, " +
+			"they are returned as a GeoJSON FeatureCollection of points instead " +
+			"(stops without coordinates are omitted).",
+		query: []parameter{
+			{"from", "integer", "stop to depart from", true},
+			{"minutes", "integer", fmt.Sprintf("maximum travel time (%d by default)", defaultIsochroneMinutes), false},
+			{"depart", "string", "departure time (HH:MM, now by default)", false},
+			{"day_type", "string", "workday, holiday or preholiday (today's by default)", false},
+			{"date", "string", "date whose day type to use instead of day_type (YYYY-MM-DD)", false},
+			{"format", "string", "json or geojson", false},
+			{"lang", "string", "bg or en", false},
+		},
+		response: []*planner.Reach{},
+	})
+	s.route("GET", "/transport/line/:vehicle/:number/routes", jsonHandler(s.routes), &endpoint{
+		scope:   backend.ScopeStatic,
+		summary: "Routes of a line",
+		query: []parameter{
+			{"lang", "string", "bg or en", false},
+		},
+		response: []*common.Route{},
+	})
+	s.route("GET", "/transport/line/:vehicle/:number/changes", jsonHandler(s.lineChanges), &endpoint{
+		scope:   backend.ScopeStatic,
+		summary: "Timetable changes of a line",
+		query: []parameter{
+			{"since", "string", "only return changes after this date (YYYY-MM-DD)", false},
+		},
+		response: []*backend.TimetableChange{},
+	})
+	s.route("GET", "/transport/line/:vehicle/:number/punctuality", jsonHandler(s.punctuality), &endpoint{
+		scope:   backend.ScopeStatic,
+		summary: "Punctuality of a line per stop and hour of the day",
+		description: fmt.Sprintf(
+			"Based on the collected realtime arrivals. Arrivals at most %d minute early "+
+				"and at most %d minutes late are on time.",
+			backend.OnTimeEarliness, backend.OnTimeLateness,
+		),
+		query: []parameter{
+			{"stop", "integer", "only return the punctuality at this stop", false},
+			{"from", "string", "first day (YYYY-MM-DD, 30 days before the last one by default)", false},
+			{"to", "string", "last day (YYYY-MM-DD, today by default)", false},
+		},
+		response: []*backend.Punctuality{},
+	})
+	s.route("GET", "/transport/list/", jsonHandler(s.transports), &endpoint{
+		scope:    backend.ScopeStatic,
+		summary:  "All lines",
+		response: []*common.Line{},
+	})
+	s.route("GET", "/stops/nearby", jsonHandler(s.nearbyStops), &endpoint{
+		scope:   backend.ScopeStatic,
+		summary: "Stops near a point, ordered by distance",
+		query: []parameter{
+			{"lat", "number", "latitude of the point", true},
+			{"lon", "number", "longitude of the point", true},
+			{"radius", "number", "search radius in metres", false},
+			{"limit", "integer", "maximum number of stops", false},
+			{"lang", "string", "bg or en", false},
+		},
+		response: []*common.NearbyStop{},
+	})
+	s.route("GET", "/stops/search", jsonHandler(s.searchStops), &endpoint{
+		scope:   backend.ScopeStatic,
+		summary: "Stops whose name or code match a query",
+		query: []parameter{
+			{"q", "string", "search query", true},
+			{"limit", "integer", "maximum number of stops", false},
+			{"lang", "string", "bg or en", false},
+		},
+		response: []*common.Stop{},
+	})
+	s.route("GET", "/gtfs-realtime/trip-updates", s.tripUpdates, &endpoint{
+		scope:       backend.ScopeRealtime,
+		summary:     "GTFS-Realtime trip updates feed",
+		response:    "",
+		contentType: "application/x-protobuf",
+	})
+	s.route("GET", "/gtfs-realtime/trip-updates.json", s.tripUpdatesJSON, &endpoint{
+		scope:    backend.ScopeRealtime,
+		summary:  "GTFS-Realtime trip updates feed in JSON",
+		response: map[string]interface{}{},
+	})
+	s.route("GET", "/admin/usage", jsonHandler(s.apiUsage), &endpoint{
+		scope:   backend.ScopeAdmin,
+		summary: "Number of requests made with each API key per route and day",
+		query: []parameter{
+			{"since", "string", "first day to return (YYYY-MM-DD, 30 days ago by default)", false},
+			{"key", "string", "only return the usage of the API key with this prefix", false},
+		},
+		response: []*backend.Usage{},
+	})
+}
+
+// Close stores the API usage which hasn't been stored yet. It must be
+// called after the server stops handling requests.
+func (s *Server) Close() {
+	s.usage.stop()
+}
+
 // ServeHTTP implements the HTTP handler interface
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	err := s.checkAPIKey(r)
-	if err != nil {
-		http.Error(
-			w,
-			fmt.Sprintf("unable to verify api key: %s", err),
-			http.StatusForbidden,
-		)
-		return
-	}
+	r = withRequestID(w, r)
 
 	s.router.ServeHTTP(w, r)
 }
@@ -54,14 +301,58 @@ func (s *Server) info(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 	message, err := s.backend.Info()
 
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Info failed: %s", err), 500)
+		writeError(w, r, fmt.Errorf("Info failed: %s", err))
 		return
 	}
 
 	fmt.Fprintf(w, "%s", message)
 }
 
-func (s *Server) checkAPIKey(r *http.Request) error {
+// authorised wraps a handle so that it's only called for requests with a
+// valid API key which has the endpoint's scope and hasn't exceeded its rate
+// limit or daily quota. The requests are counted in the key's usage.
+func (s *Server) authorised(doc *endpoint, handle httprouter.Handle) httprouter.Handle {
+	scope := doc.scope
+	limiter := s.rateLimiter
+	if scope == backend.ScopeRealtime {
+		limiter = s.realtimeRateLimiter
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		key, err := s.checkAPIKey(r)
+		if err == nil {
+			err = checkScope(key, scope)
+		}
+		if err == nil {
+			err = checkRateLimit(w, limiter, key)
+		}
+		if err == nil {
+			err = checkQuota(w, s.quota, key)
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		r, usage := withRequestUsage(r.WithContext(context.WithValue(r.Context(), apiKeyKey, key)))
+		handle(w, r, params)
+
+		if s.usage != nil {
+			s.usage.record(key.ID, doc.path, time.Now(), usage.upstreamCost)
+		}
+	}
+}
+
+const apiKeyKey contextKey = 1
+
+// requestAPIKey returns the API key the request was authorised with (nil
+// for public endpoints)
+func requestAPIKey(r *http.Request) *backend.APIKey {
+	key, _ := r.Context().Value(apiKeyKey).(*backend.APIKey)
+	return key
+}
+
+func (s *Server) checkAPIKey(r *http.Request) (*backend.APIKey, error) {
 	var apiKey string
 
 	user, password, hasAuth := r.BasicAuth()
@@ -80,34 +371,103 @@ func (s *Server) checkAPIKey(r *http.Request) error {
 	}
 
 	if apiKey == "" {
-		return fmt.Errorf("API Key is empty")
+		return nil, &apiError{http.StatusForbidden, codeForbidden, "API Key is empty"}
 	}
 
 	return s.backend.CheckAPIKey(apiKey)
 }
 
+// checkScope returns an error if the key doesn't have the scope
+func checkScope(key *backend.APIKey, scope backend.Scope) error {
+	if !key.HasScope(scope) {
+		return &apiError{
+			http.StatusForbidden, codeForbidden,
+			fmt.Sprintf("API key doesn't have the [%s] scope", scope),
+		}
+	}
+	return nil
+}
+
+// checkRateLimit takes a request from the key's bucket, sets the rate limit
+// headers and returns an error if the key has exceeded its limit.
+// X-RateLimit-Reset is the number of seconds until the limit is fully
+// replenished.
+func checkRateLimit(w http.ResponseWriter, limiter *rateLimiter, key *backend.APIKey) error {
+	if limiter == nil {
+		return nil
+	}
+
+	status := limiter.take(key.ID)
+
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", status.limit))
+	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", status.remaining))
+	w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", ceilSeconds(status.reset)))
+
+	if !status.allowed {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", ceilSeconds(status.retryAfter)))
+		return &apiError{
+			http.StatusTooManyRequests, codeRateLimited,
+			fmt.Sprintf("rate limit exceeded, retry in %d seconds", ceilSeconds(status.retryAfter)),
+		}
+	}
+
+	return nil
+}
+
+// checkQuota counts a request in the key's daily quota, sets the quota
+// headers and returns an error if the key has used up its quota.
+// X-Quota-Reset is the number of seconds until the quota is renewed.
+func checkQuota(w http.ResponseWriter, quota *quota, key *backend.APIKey) error {
+	if quota == nil {
+		return nil
+	}
+
+	status, err := quota.take(key.ID)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("X-Quota-Limit", fmt.Sprintf("%d", status.limit))
+	w.Header().Set("X-Quota-Remaining", fmt.Sprintf("%d", status.remaining))
+	w.Header().Set("X-Quota-Reset", fmt.Sprintf("%d", ceilSeconds(status.reset)))
+
+	if !status.allowed {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", ceilSeconds(status.reset)))
+		return &apiError{
+			http.StatusTooManyRequests, codeQuotaExceeded,
+			fmt.Sprintf("daily quota of %d requests exceeded", status.limit),
+		}
+	}
+
+	return nil
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
 // jsonHandler wraps a function which returns JSON-marshable data (or an error)
 // and returns a httrouter Handle which calls the function upon a request
-func jsonHandler(handler func(params httprouter.Params) (interface{}, error)) httprouter.Handle {
+func jsonHandler(handler func(r *http.Request, params httprouter.Params) (interface{}, error)) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
-		object, err := handler(params)
+		object, err := handler(r, params)
 		if err != nil {
-			http.Error(
-				w,
-				fmt.Sprintf("error handling request: %s", err),
-				http.StatusInternalServerError,
-			)
+			writeError(w, r, err)
+			return
 		}
 
-		data, err := json.MarshalIndent(object, "", "    ")
-		if err != nil {
-			http.Error(
-				w,
-				fmt.Sprintf("error marshaling data: %s", err),
-				http.StatusInternalServerError,
-			)
-		}
+		writeJSON(w, r, object)
+	}
+}
 
-		w.Write(data)
+// writeJSON writes the JSON representation of the object as a response
+func writeJSON(w http.ResponseWriter, r *http.Request, object interface{}) {
+	data, err := json.MarshalIndent(object, "", "    ")
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error marshaling data: %s", err))
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
 }
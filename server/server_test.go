@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/backend"
+)
+
+func TestServer_NoAPIKey(t *testing.T) {
+	s := testServer()
+
+	for _, path := range []string{"/info", "/stop/2193/arrivals/realtime"} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s without an API key returned %d", path, w.Code)
+		}
+	}
+}
+
+func TestCheckScope(t *testing.T) {
+	key := &backend.APIKey{
+		Prefix:    "foo",
+		CreatedAt: time.Now(),
+		Scopes:    []backend.Scope{backend.ScopeStatic},
+	}
+
+	err := checkScope(key, backend.ScopeStatic)
+	if err != nil {
+		t.Errorf("key with static scope can't access static endpoint: %s", err)
+	}
+
+	err = checkScope(key, backend.ScopeRealtime)
+	if err == nil || toAPIError(err).status != http.StatusForbidden {
+		t.Errorf("key without realtime scope can access realtime endpoint: %v", err)
+	}
+}
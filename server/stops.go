@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	defaultNearbyRadius = 500
+	maxNearbyRadius     = 5000
+	defaultNearbyLimit  = 20
+	maxNearbyLimit      = 100
+	defaultSearchLimit  = 10
+	maxSearchLimit      = 100
+)
+
+func (s *Server) nearbyStops(r *http.Request, params httprouter.Params) (interface{}, error) {
+	query := r.URL.Query()
+
+	lang, err := requestLanguage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	latitude, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		return nil, badRequest("invalid latitude [%s]", query.Get("lat"))
+	}
+
+	longitude, err := strconv.ParseFloat(query.Get("lon"), 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		return nil, badRequest("invalid longitude [%s]", query.Get("lon"))
+	}
+
+	radius := float64(defaultNearbyRadius)
+	if query.Get("radius") != "" {
+		radius, err = strconv.ParseFloat(query.Get("radius"), 64)
+		if err != nil || radius <= 0 || radius > maxNearbyRadius {
+			return nil, badRequest(
+				"invalid radius [%s] (must be at most %d metres)",
+				query.Get("radius"), maxNearbyRadius,
+			)
+		}
+	}
+
+	limit := defaultNearbyLimit
+	if query.Get("limit") != "" {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 || limit > maxNearbyLimit {
+			return nil, badRequest(
+				"invalid limit [%s] (must be at most %d)",
+				query.Get("limit"), maxNearbyLimit,
+			)
+		}
+	}
+
+	stops, err := s.backend.NearbyStops(latitude, longitude, radius, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not get nearby stops: %s", err)
+	}
+
+	for _, stop := range stops {
+		localiseStops(lang, stop.Stop)
+	}
+
+	return stops, nil
+}
+
+func (s *Server) searchStops(r *http.Request, params httprouter.Params) (interface{}, error) {
+	query := r.URL.Query()
+
+	lang, err := requestLanguage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimSpace(query.Get("q"))
+	if text == "" {
+		return nil, badRequest("empty search query")
+	}
+
+	limit := defaultSearchLimit
+	if query.Get("limit") != "" {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 || limit > maxSearchLimit {
+			return nil, badRequest(
+				"invalid limit [%s] (must be at most %d)",
+				query.Get("limit"), maxSearchLimit,
+			)
+		}
+	}
+
+	stops, err := s.backend.SearchStops(text, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not search for stops: %s", err)
+	}
+
+	localiseStops(lang, stops...)
+
+	return stops, nil
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DexterLB/skgt_api/realtime"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// defaultStreamPollInterval is used when no poll interval is configured
+	defaultStreamPollInterval = 30 * time.Second
+	// streamHeartbeatInterval is how often a comment is sent to keep idle
+	// streams from being closed by proxies
+	streamHeartbeatInterval = 15 * time.Second
+)
+
+// streamEvent is a single server-sent event. For "arrivals" events,
+// arrivals are the arrivals which data is the JSON representation of.
+type streamEvent struct {
+	name     string
+	data     []byte
+	arrivals []*realtime.LineArrivals
+}
+
+// arrivalsHub polls the realtime arrivals of stops which have subscribers.
+// There is a single poller for each stop, shared by all of its subscribers,
+// which only sends events when the arrivals change.
+type arrivalsHub struct {
+	interval time.Duration
+	fetch    func(stopID int) ([]*realtime.LineArrivals, error)
+
+	mutex   sync.Mutex
+	pollers map[int]*poller
+}
+
+type poller struct {
+	subscribers map[chan *streamEvent]struct{}
+	last        *streamEvent
+	stop        chan struct{}
+}
+
+func newArrivalsHub(
+	interval time.Duration,
+	fetch func(stopID int) ([]*realtime.LineArrivals, error),
+) *arrivalsHub {
+	return &arrivalsHub{
+		interval: interval,
+		fetch:    fetch,
+		pollers:  make(map[int]*poller),
+	}
+}
+
+// subscribe returns a channel which receives the events for a stop, starting
+// with the latest one (if any). Only the latest event is kept for slow
+// subscribers. unsubscribe must be called when the events are no longer
+// needed.
+func (h *arrivalsHub) subscribe(stopID int) (events <-chan *streamEvent, unsubscribe func()) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	p, ok := h.pollers[stopID]
+	if !ok {
+		p = &poller{
+			subscribers: make(map[chan *streamEvent]struct{}),
+			stop:        make(chan struct{}),
+		}
+		h.pollers[stopID] = p
+		go h.poll(stopID, p)
+	}
+
+	channel := make(chan *streamEvent, 1)
+	if p.last != nil {
+		channel <- p.last
+	}
+	p.subscribers[channel] = struct{}{}
+
+	return channel, func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+
+		delete(p.subscribers, channel)
+		if len(p.subscribers) == 0 && h.pollers[stopID] == p {
+			close(p.stop)
+			delete(h.pollers, stopID)
+		}
+	}
+}
+
+func (h *arrivalsHub) poll(stopID int, p *poller) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		event := h.event(stopID)
+
+		h.mutex.Lock()
+		if p.last == nil || p.last.name != event.name || !bytes.Equal(p.last.data, event.data) {
+			p.last = event
+			for channel := range p.subscribers {
+				// drop the previous event if it hasn't been received yet
+				select {
+				case <-channel:
+				default:
+				}
+				channel <- event
+			}
+		}
+		h.mutex.Unlock()
+
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// event gets the arrivals at a stop and makes an event from them
+func (h *arrivalsHub) event(stopID int) *streamEvent {
+	arrivals, err := h.fetch(stopID)
+	if err != nil {
+		data, _ := json.Marshal(&errorResponse{
+			Code:    codeUpstreamError,
+			Message: fmt.Sprintf("unable to get realtime arrivals: %s", err),
+		})
+		return &streamEvent{name: "error", data: data}
+	}
+
+	data, err := json.Marshal(arrivals)
+	if err != nil {
+		data, _ = json.Marshal(&errorResponse{
+			Code:    codeInternalError,
+			Message: fmt.Sprintf("error marshaling data: %s", err),
+		})
+		return &streamEvent{name: "error", data: data}
+	}
+
+	return &streamEvent{name: "arrivals", data: data, arrivals: arrivals}
+}
+
+func (s *Server) streamArrivals(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	stopID, err := strconv.Atoi(params.ByName("stop_id"))
+	if err != nil {
+		writeError(w, r, badRequest("unable to parse stop ID: %s", err))
+		return
+	}
+
+	err = s.backend.CheckStop(stopID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	events, unsubscribe := s.arrivalsHub.subscribe(stopID)
+	defer unsubscribe()
+
+	serveEvents(w, r, events)
+}
+
+// serveEvents writes events as a server-sent event stream until the
+// client disconnects
+func serveEvents(w http.ResponseWriter, r *http.Request, events <-chan *streamEvent) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, event.data)
+		case <-heartbeat.C:
+			fmt.Fprintf(w, ": heartbeat\n\n")
+		}
+		flusher.Flush()
+	}
+}
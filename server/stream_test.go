@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/realtime"
+)
+
+func receive(t *testing.T, events <-chan *streamEvent) *streamEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+		return nil
+	}
+}
+
+func TestArrivalsHub(t *testing.T) {
+	var fetches int32
+	var number atomic.Value
+	number.Store("10")
+
+	hub := newArrivalsHub(10*time.Millisecond, func(stopID int) ([]*realtime.LineArrivals, error) {
+		atomic.AddInt32(&fetches, 1)
+		if number.Load().(string) == "" {
+			return nil, errors.New("SKGT is down")
+		}
+		return []*realtime.LineArrivals{
+			{Line: &common.Line{Vehicle: common.Tram, Number: number.Load().(string)}},
+		}, nil
+	})
+
+	first, unsubscribeFirst := hub.subscribe(1700)
+	event := receive(t, first)
+	if event.name != "arrivals" || !strings.Contains(string(event.data), `"Number":"10"`) {
+		t.Errorf("wrong first event: %s %s", event.name, event.data)
+	}
+
+	second, unsubscribeSecond := hub.subscribe(1700)
+	event = receive(t, second)
+	if !strings.Contains(string(event.data), `"Number":"10"`) {
+		t.Errorf("new subscriber didn't get the latest event: %s", event.data)
+	}
+
+	// unchanged arrivals don't produce events
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case event := <-first:
+		t.Errorf("event for unchanged arrivals: %s", event.data)
+	default:
+	}
+
+	number.Store("12")
+	for _, events := range []<-chan *streamEvent{first, second} {
+		event = receive(t, events)
+		if !strings.Contains(string(event.data), `"Number":"12"`) {
+			t.Errorf("wrong event after change: %s", event.data)
+		}
+	}
+
+	number.Store("")
+	event = receive(t, first)
+	if event.name != "error" || !strings.Contains(string(event.data), "SKGT is down") {
+		t.Errorf("wrong error event: %s %s", event.name, event.data)
+	}
+
+	unsubscribeFirst()
+	unsubscribeSecond()
+
+	hub.mutex.Lock()
+	pollers := len(hub.pollers)
+	hub.mutex.Unlock()
+	if pollers != 0 {
+		t.Errorf("%d pollers left without subscribers", pollers)
+	}
+
+	// the poller stops polling
+	time.Sleep(20 * time.Millisecond)
+	stopped := atomic.LoadInt32(&fetches)
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&fetches) != stopped {
+		t.Errorf("poller still running after all subscribers left")
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	events := make(chan *streamEvent, 2)
+	events <- &streamEvent{name: "arrivals", data: []byte(`[]`)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("GET", "/stop/1700/arrivals/stream", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		serveEvents(w, r, events)
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+
+	if w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("wrong content type: %s", w.Header().Get("Content-Type"))
+	}
+	if w.Body.String() != "event: arrivals\ndata: []\n\n" {
+		t.Errorf("wrong body: %q", w.Body.String())
+	}
+}
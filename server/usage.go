@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DexterLB/skgt_api/backend"
+	"github.com/julienschmidt/httprouter"
+)
+
+// defaultUsageFlushInterval is used when no flush interval is configured
+const defaultUsageFlushInterval = time.Minute
+
+// usageRecorder counts requests per API key, route and day and
+// periodically adds the counts to the stored usage
+type usageRecorder struct {
+	flush func(records []*backend.UsageRecord) error
+
+	mutex  sync.Mutex
+	counts map[usageEntry]*usageCounts
+
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+type usageEntry struct {
+	apiKey int64
+	day    string
+	route  string
+}
+
+type usageCounts struct {
+	requests     int64
+	upstreamCost int64
+}
+
+func newUsageRecorder(flush func(records []*backend.UsageRecord) error) *usageRecorder {
+	return &usageRecorder{
+		flush:   flush,
+		counts:  make(map[usageEntry]*usageCounts),
+		stopped: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// record counts a request
+func (u *usageRecorder) record(apiKey int64, route string, now time.Time, upstreamCost int64) {
+	u.add(usageEntry{apiKey, now.Format("2006-01-02"), route}, &usageCounts{1, upstreamCost})
+}
+
+func (u *usageRecorder) add(entry usageEntry, counts *usageCounts) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if u.counts[entry] == nil {
+		u.counts[entry] = &usageCounts{}
+	}
+	u.counts[entry].requests += counts.requests
+	u.counts[entry].upstreamCost += counts.upstreamCost
+}
+
+// flushUsage stores all counted requests. If storing fails, they are kept
+// for the next flush.
+func (u *usageRecorder) flushUsage() error {
+	u.mutex.Lock()
+	counts := u.counts
+	u.counts = make(map[usageEntry]*usageCounts)
+	u.mutex.Unlock()
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	records := make([]*backend.UsageRecord, 0, len(counts))
+	for entry, count := range counts {
+		day, _ := time.Parse("2006-01-02", entry.day)
+		records = append(records, &backend.UsageRecord{
+			APIKeyID:     entry.apiKey,
+			Day:          day,
+			Route:        entry.route,
+			Requests:     count.requests,
+			UpstreamCost: count.upstreamCost,
+		})
+	}
+
+	err := u.flush(records)
+	if err != nil {
+		for entry, count := range counts {
+			u.add(entry, count)
+		}
+	}
+
+	return err
+}
+
+// run flushes the usage on every interval until stop is called
+func (u *usageRecorder) run(interval time.Duration) {
+	defer close(u.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			u.logFlush()
+		case <-u.stopped:
+			u.logFlush()
+			return
+		}
+	}
+}
+
+// stop makes run flush the remaining usage and return, and waits for it
+func (u *usageRecorder) stop() {
+	close(u.stopped)
+	<-u.done
+}
+
+func (u *usageRecorder) logFlush() {
+	err := u.flushUsage()
+	if err != nil {
+		log.Printf("unable to store API usage: %s", err)
+	}
+}
+
+// requestUsage is the cost of a single request
+type requestUsage struct {
+	upstreamCost int64
+}
+
+const requestUsageKey contextKey = 2
+
+func withRequestUsage(r *http.Request) (*http.Request, *requestUsage) {
+	usage := &requestUsage{}
+	return r.WithContext(context.WithValue(r.Context(), requestUsageKey, usage)), usage
+}
+
+// addUpstreamCost records that the request made lookups on SKGT's
+// virtual board. It may be called concurrently.
+func addUpstreamCost(r *http.Request, lookups int64) {
+	usage, ok := r.Context().Value(requestUsageKey).(*requestUsage)
+	if ok {
+		atomic.AddInt64(&usage.upstreamCost, lookups)
+	}
+}
+
+func (s *Server) apiUsage(r *http.Request, params httprouter.Params) (interface{}, error) {
+	query := r.URL.Query()
+
+	since := time.Now().AddDate(0, 0, -30)
+	if query.Get("since") != "" {
+		var err error
+		since, err = time.Parse("2006-01-02", query.Get("since"))
+		if err != nil {
+			return nil, badRequest("unable to parse date: %s", err)
+		}
+	}
+
+	usage, err := s.backend.APIUsage(query.Get("key"), since)
+	if err == backend.ErrWrongAPIKey {
+		return nil, notFound("no such API key")
+	} else if err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
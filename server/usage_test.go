@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/backend"
+)
+
+func TestUsageRecorder(t *testing.T) {
+	var stored []*backend.UsageRecord
+	fail := false
+	recorder := newUsageRecorder(func(records []*backend.UsageRecord) error {
+		if fail {
+			return errors.New("database is on fire")
+		}
+		stored = append(stored, records...)
+		return nil
+	})
+
+	day := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	route := "/stop/:stop_id/arrivals/realtime"
+
+	recorder.record(1, route, day, 1)
+	recorder.record(1, route, day, 0)
+
+	fail = true
+	err := recorder.flushUsage()
+	if err == nil {
+		t.Fatalf("no error when storing failed")
+	}
+
+	recorder.record(1, route, day, 1)
+	recorder.record(1, route, day.AddDate(0, 0, 1), 0)
+	recorder.record(2, "/stops/search", day, 0)
+
+	fail = false
+	err = recorder.flushUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stored) != 3 {
+		t.Fatalf("stored %d records instead of 3", len(stored))
+	}
+
+	for _, record := range stored {
+		if record.APIKeyID == 1 && record.Day.Day() == 1 {
+			if record.Requests != 3 || record.UpstreamCost != 2 {
+				t.Errorf("wrong counts after failed flush: %+v", record)
+			}
+		}
+	}
+
+	stored = nil
+	err = recorder.flushUsage()
+	if err != nil || len(stored) != 0 {
+		t.Errorf("requests were stored twice: %v %v", stored, err)
+	}
+}
+
+func TestAddUpstreamCost(t *testing.T) {
+	r, usage := withRequestUsage(httptest.NewRequest("GET", "/foo", nil))
+
+	addUpstreamCost(r, 1)
+	addUpstreamCost(r, 2)
+	if usage.upstreamCost != 3 {
+		t.Errorf("upstream cost is %d instead of 3", usage.upstreamCost)
+	}
+
+	// requests without usage are ignored
+	addUpstreamCost(httptest.NewRequest("GET", "/foo", nil), 1)
+}
+
+func TestUsageRecorder_Stop(t *testing.T) {
+	var stored []*backend.UsageRecord
+	recorder := newUsageRecorder(func(records []*backend.UsageRecord) error {
+		stored = append(stored, records...)
+		return nil
+	})
+	go recorder.run(time.Hour)
+
+	recorder.record(1, "/stops/search", time.Now(), 0)
+	recorder.stop()
+
+	if len(stored) != 1 {
+		t.Errorf("usage was not stored when stopping: %v", stored)
+	}
+}
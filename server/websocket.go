@@ -0,0 +1,519 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/realtime"
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// maxSubscriptions is the maximum number of lines a WebSocket client
+	// may subscribe to
+	maxSubscriptions = 100
+	// sessionTTL is for how long a session can be resumed after its
+	// connection is closed
+	sessionTTL = 5 * time.Minute
+	// websocketWriteTimeout is how long writing a message may take before
+	// the client is considered gone
+	websocketWriteTimeout = 10 * time.Second
+)
+
+// subscription is a line at a stop
+type subscription struct {
+	Stop int
+	Line common.Line
+}
+
+// clientMessage is a message sent by WebSocket clients
+type clientMessage struct {
+	Type          string // "subscribe" or "unsubscribe"
+	Subscriptions []subscription
+}
+
+// serverMessage is a message sent to WebSocket clients.
+//
+// "welcome" is sent first and contains the token with which the session
+// can be resumed. "arrivals" contains the arrivals of all subscriptions
+// whose arrivals changed since the previous message. "heartbeat" is sent
+// periodically. "error" is sent for invalid client messages and when the
+// arrivals at a stop can't be obtained.
+type serverMessage struct {
+	Type     string
+	Token    string            `json:",omitempty"`
+	Sequence uint64            `json:",omitempty"`
+	Changes  []*arrivalsChange `json:",omitempty"`
+	Stop     int               `json:",omitempty"`
+	Error    *errorResponse    `json:",omitempty"`
+}
+
+// arrivalsChange contains the new arrivals of a subscription
+type arrivalsChange struct {
+	subscription
+	Arrivals []*realtime.Arrival
+}
+
+// wsSession is the state of a WebSocket client, which outlives its
+// connection for a while so that the client can resume it
+type wsSession struct {
+	token         string
+	subscriptions map[subscription]bool
+	// sent contains the JSON representation of the last arrivals sent for
+	// each subscription
+	sent         map[subscription][]byte
+	sequence     uint64
+	connected    bool
+	disconnected time.Time
+}
+
+// sessionStore keeps WebSocket sessions until they expire
+type sessionStore struct {
+	ttl time.Duration
+
+	mutex    sync.Mutex
+	sessions map[string]*wsSession
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{
+		ttl:      ttl,
+		sessions: make(map[string]*wsSession),
+	}
+}
+
+// open creates a new session, or resumes the one with the given token if
+// it's not empty. sequence is the sequence number of the last message the
+// client received: if it has missed any messages, all arrivals are sent
+// again.
+func (s *sessionStore) open(token string, sequence uint64) (*wsSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for key, session := range s.sessions {
+		if !session.connected && now.Sub(session.disconnected) >= s.ttl {
+			delete(s.sessions, key)
+		}
+	}
+
+	if token == "" {
+		token, err := randomToken()
+		if err != nil {
+			return nil, err
+		}
+
+		session := &wsSession{
+			token:         token,
+			subscriptions: make(map[subscription]bool),
+			sent:          make(map[subscription][]byte),
+			connected:     true,
+		}
+		s.sessions[token] = session
+		return session, nil
+	}
+
+	session, ok := s.sessions[token]
+	if !ok {
+		return nil, notFound("unknown or expired session token")
+	}
+	if session.connected {
+		return nil, &apiError{http.StatusConflict, codeConflict, "session is already connected"}
+	}
+
+	session.connected = true
+	if sequence != session.sequence {
+		session.sent = make(map[subscription][]byte)
+	}
+
+	return session, nil
+}
+
+// close marks the session as disconnected, so that it can be resumed
+func (s *sessionStore) close(session *wsSession) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session.connected = false
+	session.disconnected = time.Now()
+}
+
+func randomToken() (string, error) {
+	tokenBytes := make([]byte, 16)
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(tokenBytes), nil
+}
+
+func (s *Server) websocketArrivals(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	s.serveWebSocket(w, r, s.backend.CheckStop)
+}
+
+// serveWebSocket serves a WebSocket session, checking the stops clients
+// subscribe to with checkStop
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request, checkStop func(stopID int) error) {
+	if !s.allowedOrigin(r) {
+		writeError(w, r, &apiError{
+			http.StatusForbidden, codeForbidden,
+			fmt.Sprintf("origin [%s] is not allowed", r.Header.Get("Origin")),
+		})
+		return
+	}
+
+	query := r.URL.Query()
+
+	var sequence uint64
+	if query.Get("sequence") != "" {
+		var err error
+		sequence, err = strconv.ParseUint(query.Get("sequence"), 10, 64)
+		if err != nil {
+			writeError(w, r, badRequest("unable to parse sequence number: %s", err))
+			return
+		}
+	}
+
+	session, err := s.wsSessions.open(query.Get("token"), sequence)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer s.wsSessions.close(session)
+
+	upgrader := websocket.Upgrader{
+		// the origin has already been checked
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already responded with an error
+		return
+	}
+	defer conn.Close()
+
+	newWSConnection(conn, session, s.arrivalsHub, checkStop).run()
+}
+
+// allowedOrigin checks if a WebSocket connection may be opened from the
+// request's origin: the API's own host or one of the configured origins.
+// Browsers attach cached Basic auth credentials to WebSocket handshakes,
+// so any other page could open connections with the visitor's API key.
+// Requests without an origin don't come from browsers and are allowed.
+func (s *Server) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	originURL, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(originURL.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range s.config.Server.WebSocketOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wsConnection serves a session over a WebSocket connection
+type wsConnection struct {
+	conn      *websocket.Conn
+	session   *wsSession
+	hub       *arrivalsHub
+	checkStop func(stopID int) error
+
+	updates chan *stopEvent
+	stops   map[int]*stopWatch
+	latest  map[int]*streamEvent
+}
+
+type stopEvent struct {
+	stopID int
+	event  *streamEvent
+}
+
+type stopWatch struct {
+	unsubscribe func()
+	done        chan struct{}
+}
+
+func newWSConnection(
+	conn *websocket.Conn,
+	session *wsSession,
+	hub *arrivalsHub,
+	checkStop func(stopID int) error,
+) *wsConnection {
+	return &wsConnection{
+		conn:      conn,
+		session:   session,
+		hub:       hub,
+		checkStop: checkStop,
+		updates:   make(chan *stopEvent),
+		stops:     make(map[int]*stopWatch),
+		latest:    make(map[int]*streamEvent),
+	}
+}
+
+// run serves the connection until it's closed
+func (c *wsConnection) run() {
+	closed := make(chan struct{})
+	defer close(closed)
+
+	messages := make(chan []byte)
+	readErrors := make(chan error, 1)
+	go func() {
+		for {
+			_, data, err := c.conn.ReadMessage()
+			if err != nil {
+				readErrors <- err
+				return
+			}
+
+			select {
+			case messages <- data:
+			case <-closed:
+				return
+			}
+		}
+	}()
+
+	defer func() {
+		for stopID := range c.stops {
+			c.unwatch(stopID)
+		}
+	}()
+
+	err := c.send(&serverMessage{
+		Type:     "welcome",
+		Token:    c.session.token,
+		Sequence: c.session.sequence,
+	})
+	if err != nil {
+		return
+	}
+
+	for subscription := range c.session.subscriptions {
+		c.watch(subscription.Stop)
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case data := <-messages:
+			err = c.handle(data)
+		case update := <-c.updates:
+			c.latest[update.stopID] = update.event
+			err = c.sendChanges(update.stopID)
+		case <-heartbeat.C:
+			err = c.send(&serverMessage{Type: "heartbeat", Sequence: c.session.sequence})
+		case <-readErrors:
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle handles a client message. Only errors which close the connection
+// are returned, the rest are sent to the client.
+func (c *wsConnection) handle(data []byte) error {
+	message := &clientMessage{}
+	err := json.Unmarshal(data, message)
+	if err != nil {
+		return c.sendError(0, badRequest("unable to parse message: %s", err))
+	}
+
+	switch message.Type {
+	case "subscribe":
+		if len(c.session.subscriptions)+len(message.Subscriptions) > maxSubscriptions {
+			return c.sendError(0, badRequest("at most %d subscriptions are allowed", maxSubscriptions))
+		}
+
+		changedStops := make(map[int]bool)
+		for _, subscription := range message.Subscriptions {
+			if _, ok := c.stops[subscription.Stop]; !ok {
+				err = c.checkStop(subscription.Stop)
+				if err != nil {
+					err = c.sendError(subscription.Stop, err)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				c.watch(subscription.Stop)
+			}
+
+			c.session.subscriptions[subscription] = true
+			changedStops[subscription.Stop] = true
+		}
+
+		for stopID := range changedStops {
+			err = c.sendChanges(stopID)
+			if err != nil {
+				return err
+			}
+		}
+	case "unsubscribe":
+		for _, subscription := range message.Subscriptions {
+			delete(c.session.subscriptions, subscription)
+			delete(c.session.sent, subscription)
+		}
+
+		for stopID := range c.stops {
+			if len(c.subscriptionsAt(stopID)) == 0 {
+				c.unwatch(stopID)
+			}
+		}
+	default:
+		return c.sendError(0, badRequest("unknown message type [%s]", message.Type))
+	}
+
+	return nil
+}
+
+// watch starts forwarding the events for a stop to c.updates
+func (c *wsConnection) watch(stopID int) {
+	if _, ok := c.stops[stopID]; ok {
+		return
+	}
+
+	events, unsubscribe := c.hub.subscribe(stopID)
+	watch := &stopWatch{unsubscribe: unsubscribe, done: make(chan struct{})}
+	c.stops[stopID] = watch
+
+	go func() {
+		for {
+			select {
+			case event := <-events:
+				select {
+				case c.updates <- &stopEvent{stopID, event}:
+				case <-watch.done:
+					return
+				}
+			case <-watch.done:
+				return
+			}
+		}
+	}()
+}
+
+func (c *wsConnection) unwatch(stopID int) {
+	watch := c.stops[stopID]
+	close(watch.done)
+	watch.unsubscribe()
+
+	delete(c.stops, stopID)
+	delete(c.latest, stopID)
+}
+
+// subscriptionsAt returns the subscriptions for a stop, sorted by line
+func (c *wsConnection) subscriptionsAt(stopID int) []subscription {
+	var subscriptions []subscription
+	for subscription := range c.session.subscriptions {
+		if subscription.Stop == stopID {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		a, b := subscriptions[i].Line, subscriptions[j].Line
+		if a.Vehicle != b.Vehicle {
+			return a.Vehicle < b.Vehicle
+		}
+		return a.Number < b.Number
+	})
+
+	return subscriptions
+}
+
+// sendChanges sends the arrivals of the subscriptions for a stop which have
+// changed since they were last sent
+func (c *wsConnection) sendChanges(stopID int) error {
+	event := c.latest[stopID]
+	if event == nil {
+		return nil
+	}
+
+	if event.name == "error" {
+		apiErr := &errorResponse{}
+		_ = json.Unmarshal(event.data, apiErr)
+		return c.send(&serverMessage{Type: "error", Stop: stopID, Error: apiErr})
+	}
+
+	arrivals := make(map[common.Line][]*realtime.Arrival)
+	for _, lineArrivals := range event.arrivals {
+		arrivals[*lineArrivals.Line] = lineArrivals.Arrivals
+	}
+
+	var changes []*arrivalsChange
+	for _, subscription := range c.subscriptionsAt(stopID) {
+		lineArrivals := arrivals[subscription.Line]
+		if lineArrivals == nil {
+			lineArrivals = []*realtime.Arrival{}
+		}
+
+		data, err := json.Marshal(lineArrivals)
+		if err != nil {
+			return err
+		}
+
+		sent, ok := c.session.sent[subscription]
+		if ok && bytes.Equal(sent, data) {
+			continue
+		}
+
+		c.session.sent[subscription] = data
+		changes = append(changes, &arrivalsChange{subscription, lineArrivals})
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	c.session.sequence++
+	return c.send(&serverMessage{
+		Type:     "arrivals",
+		Sequence: c.session.sequence,
+		Changes:  changes,
+	})
+}
+
+func (c *wsConnection) sendError(stopID int, err error) error {
+	apiErr := toAPIError(err)
+	return c.send(&serverMessage{
+		Type: "error",
+		Stop: stopID,
+		Error: &errorResponse{
+			Code:    apiErr.code,
+			Message: apiErr.message,
+		},
+	})
+}
+
+func (c *wsConnection) send(message *serverMessage) error {
+	c.conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	return c.conn.WriteJSON(message)
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DexterLB/skgt_api/backend"
+	"github.com/DexterLB/skgt_api/common"
+	"github.com/DexterLB/skgt_api/config"
+	"github.com/DexterLB/skgt_api/realtime"
+	"github.com/gorilla/websocket"
+)
+
+type testWSServer struct {
+	*httptest.Server
+	minutes atomic.Value
+}
+
+// newTestWSServer serves WebSocket sessions for stop 1700, which has tram
+// 10 arriving in the stored number of minutes and tram 12 arriving in an
+// hour
+func newTestWSServer() *testWSServer {
+	server := &testWSServer{}
+	server.minutes.Store(5)
+
+	hub := newArrivalsHub(5*time.Millisecond, func(stopID int) ([]*realtime.LineArrivals, error) {
+		now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+		minutes := server.minutes.Load().(int)
+		return []*realtime.LineArrivals{
+			{
+				Line:     &common.Line{Vehicle: common.Tram, Number: "10"},
+				Arrivals: []*realtime.Arrival{{Time: now.Add(time.Duration(minutes) * time.Minute)}},
+			},
+			{
+				Line:     &common.Line{Vehicle: common.Tram, Number: "12"},
+				Arrivals: []*realtime.Arrival{{Time: now.Add(time.Hour)}},
+			},
+		}, nil
+	})
+
+	s := &Server{
+		config:      &config.Config{},
+		arrivalsHub: hub,
+		wsSessions:  newSessionStore(time.Minute),
+	}
+	s.config.Server.WebSocketOrigins = []string{"https://maps.example.com"}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serveWebSocket(w, r, func(stopID int) error {
+			if stopID != 1700 {
+				return backend.ErrNoSuchStop
+			}
+			return nil
+		})
+	}))
+
+	return server
+}
+
+func (s *testWSServer) dial(t *testing.T, query string) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+query, nil)
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) *serverMessage {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	for {
+		message := &serverMessage{}
+		err := conn.ReadJSON(message)
+		if err != nil {
+			t.Fatalf("unable to read message: %s", err)
+		}
+		if message.Type != "heartbeat" {
+			return message
+		}
+	}
+}
+
+func subscribe(t *testing.T, conn *websocket.Conn, messageType string, subscriptions ...subscription) {
+	err := conn.WriteJSON(&clientMessage{Type: messageType, Subscriptions: subscriptions})
+	if err != nil {
+		t.Fatalf("unable to send message: %s", err)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	server := newTestWSServer()
+	defer server.Close()
+
+	tram10 := subscription{1700, common.Line{Vehicle: common.Tram, Number: "10"}}
+	tram12 := subscription{1700, common.Line{Vehicle: common.Tram, Number: "12"}}
+
+	conn := server.dial(t, "")
+	welcome := readMessage(t, conn)
+	if welcome.Type != "welcome" || welcome.Token == "" {
+		t.Fatalf("wrong welcome message: %+v", welcome)
+	}
+
+	subscribe(t, conn, "subscribe", tram10, subscription{42, tram10.Line})
+
+	message := readMessage(t, conn)
+	if message.Type != "error" || message.Stop != 42 || message.Error.Code != codeNotFound {
+		t.Errorf("wrong message for unknown stop: %+v", message)
+	}
+
+	message = readMessage(t, conn)
+	if message.Type != "arrivals" || message.Sequence != 1 || len(message.Changes) != 1 {
+		t.Fatalf("wrong first arrivals: %+v", message)
+	}
+	if message.Changes[0].subscription != tram10 || len(message.Changes[0].Arrivals) != 1 {
+		t.Errorf("wrong change: %+v", message.Changes[0])
+	}
+
+	// subscribing to another line at the same stop sends only its arrivals
+	subscribe(t, conn, "subscribe", tram12)
+	message = readMessage(t, conn)
+	if message.Sequence != 2 || len(message.Changes) != 1 || message.Changes[0].subscription != tram12 {
+		t.Errorf("wrong arrivals after second subscription: %+v", message)
+	}
+
+	subscribe(t, conn, "unsubscribe", tram12)
+
+	// only the changed line is sent
+	server.minutes.Store(4)
+	message = readMessage(t, conn)
+	if message.Sequence != 3 || len(message.Changes) != 1 || message.Changes[0].subscription != tram10 {
+		t.Errorf("wrong arrivals after change: %+v", message)
+	}
+
+	conn.Close()
+	time.Sleep(20 * time.Millisecond)
+
+	// resuming after missing a message sends everything again
+	server.minutes.Store(3)
+	conn = server.dial(t, "?token="+welcome.Token+"&sequence=1")
+	defer conn.Close()
+
+	message = readMessage(t, conn)
+	if message.Type != "welcome" || message.Token != welcome.Token || message.Sequence != 3 {
+		t.Errorf("wrong welcome message after resuming: %+v", message)
+	}
+
+	message = readMessage(t, conn)
+	if message.Sequence != 4 || len(message.Changes) != 1 || message.Changes[0].subscription != tram10 {
+		t.Errorf("wrong arrivals after resuming: %+v", message)
+	}
+}
+
+func TestWebSocket_Resume(t *testing.T) {
+	server := newTestWSServer()
+	defer server.Close()
+
+	_, response, err := websocket.DefaultDialer.Dial(
+		"ws"+strings.TrimPrefix(server.URL, "http")+"?token=foo", nil,
+	)
+	if err == nil || response.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown token was accepted: %v", err)
+	}
+
+	conn := server.dial(t, "")
+	defer conn.Close()
+	welcome := readMessage(t, conn)
+
+	_, response, err = websocket.DefaultDialer.Dial(
+		"ws"+strings.TrimPrefix(server.URL, "http")+"?token="+welcome.Token, nil,
+	)
+	if err == nil || response.StatusCode != http.StatusConflict {
+		t.Errorf("session was resumed while connected: %v", err)
+	}
+}
+
+func TestSessionStore_Expiry(t *testing.T) {
+	sessions := newSessionStore(0)
+
+	session, err := sessions.open("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions.close(session)
+
+	_, err = sessions.open(session.token, 0)
+	if err == nil {
+		t.Errorf("expired session was resumed")
+	}
+}
+
+func TestWebSocket_BadSequence(t *testing.T) {
+	server := newTestWSServer()
+	defer server.Close()
+
+	_, response, err := websocket.DefaultDialer.Dial(
+		"ws"+strings.TrimPrefix(server.URL, "http")+"?token=foo&sequence=bar", nil,
+	)
+	if err == nil || response.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid sequence number was accepted: %v", err)
+	}
+}
+
+func TestWebSocket_Origin(t *testing.T) {
+	server := newTestWSServer()
+	defer server.Close()
+
+	for origin, allowed := range map[string]bool{
+		"":                          true,
+		server.URL:                  true,
+		"https://maps.example.com":  true,
+		"https://evil.example.com":  false,
+		"https://maps.example.com.": false,
+	} {
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+
+		conn, response, err := websocket.DefaultDialer.Dial(
+			"ws"+strings.TrimPrefix(server.URL, "http"), header,
+		)
+		if allowed {
+			if err != nil {
+				t.Errorf("connection from [%s] was rejected: %s", origin, err)
+				continue
+			}
+			conn.Close()
+		} else if err == nil || response.StatusCode != http.StatusForbidden {
+			t.Errorf("connection from [%s] was accepted", origin)
+			if err == nil {
+				conn.Close()
+			}
+		}
+	}
+}